@@ -0,0 +1,87 @@
+package sdnotify
+
+// Err returns the error from the most recent notification sent in the
+// background by n, or nil if that notification was sent successfully or none
+// has been sent. Background notifications include those sent by StartWatchdog
+// and KeepAlive and the statuses held back by WithStatusRateLimit, whose
+// errors cannot otherwise be returned to the caller of Notify. A watchdog loop
+// may use Err to detect that its notifications are not reaching systemd before
+// the watchdog timeout expires. If n is nil or Disabled, Err returns nil.
+func (n *Notifier) Err() error {
+	if n.disabled() {
+		return nil
+	}
+	if n.parent != nil {
+		return n.parent.Err()
+	}
+
+	n.errMu.Lock()
+	defer n.errMu.Unlock()
+
+	return n.asyncErr
+}
+
+// Errors returns a channel which receives each error that occurs while n sends
+// notifications in the background, as described by Err. Errors are discarded
+// if the channel is not being received from, so a failing background send is
+// never delayed. The channel is closed when n is closed. If n is nil or
+// Disabled, Errors returns a closed channel.
+func (n *Notifier) Errors() <-chan error {
+	if n.disabled() {
+		errC := make(chan error)
+		close(errC)
+		return errC
+	}
+	if n.parent != nil {
+		return n.parent.Errors()
+	}
+
+	n.errMu.Lock()
+	defer n.errMu.Unlock()
+
+	if n.errC == nil {
+		n.errC = make(chan error, 1)
+		if n.errClosed {
+			close(n.errC)
+		}
+	}
+
+	return n.errC
+}
+
+// background records the result err of a notification sent in the background
+// for Err and Errors.
+func (n *Notifier) background(err error) {
+	if n.parent != nil {
+		n.parent.background(err)
+		return
+	}
+
+	n.errMu.Lock()
+	defer n.errMu.Unlock()
+
+	n.asyncErr = err
+	if err == nil || n.errC == nil || n.errClosed {
+		return
+	}
+
+	select {
+	case n.errC <- err:
+	default:
+	}
+}
+
+// closeErrors closes the channel returned by Errors.
+func (n *Notifier) closeErrors() {
+	n.errMu.Lock()
+	defer n.errMu.Unlock()
+
+	if n.errClosed {
+		return
+	}
+
+	n.errClosed = true
+	if n.errC != nil {
+		close(n.errC)
+	}
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierErrors(t *testing.T) {
+	t.Setenv(sdnotify.WatchdogUsec, strconv.Itoa(int((20 * time.Millisecond).Microseconds())))
+
+	n, pc := testNotifier(t)
+	if err := n.Err(); err != nil {
+		t.Fatalf("unexpected error before sending: %v", err)
+	}
+
+	errC := n.Errors()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := n.StartWatchdog(ctx); err != nil {
+		t.Fatalf("failed to start watchdog: %v", err)
+	}
+
+	// The first watchdog notification reaches systemd.
+	_ = readString(t, pc)
+
+	// Simulate systemd going away so that later notifications fail.
+	_ = pc.Close()
+
+	select {
+	case err := <-errC:
+		if !sdnotify.IsSocketUnavailable(err) {
+			t.Fatalf("expected socket unavailable, but got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for background error")
+	}
+
+	if err := n.Err(); !sdnotify.IsSocketUnavailable(err) {
+		t.Fatalf("expected socket unavailable, but got: %v", err)
+	}
+
+	cancel()
+	_ = n.Close()
+
+	// Closing the Notifier closes the channel once any buffered error has
+	// been received.
+	for range errC {
+	}
+}
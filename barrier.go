@@ -0,0 +1,113 @@
+package sdnotify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// Barrier sends a BARRIER notification and blocks until systemd has processed
+// all notifications previously sent by the service, or until ctx is canceled.
+// This is useful for short-lived processes which must ensure that systemd has
+// received their notifications before exiting.
+//
+// If ctx is canceled or its deadline is exceeded before systemd responds,
+// Barrier returns ctx.Err(). If n is nil or Disabled, Barrier is a no-op.
+func (n *Notifier) Barrier(ctx context.Context) error {
+	if n.disabled() {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// systemd closes its copy of the write end of the pipe once all prior
+	// notifications have been processed, causing EOF on the read end.
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	err = n.writeRights("BARRIER=1", []int{int(w.Fd())})
+	_ = w.Close()
+	if err != nil {
+		return err
+	}
+
+	if d, ok := ctx.Deadline(); ok {
+		if err := r.SetReadDeadline(d); err != nil {
+			return err
+		}
+	}
+
+	// Interrupt a blocked read immediately if ctx is canceled.
+	var (
+		stopC = make(chan struct{})
+		doneC = make(chan struct{})
+	)
+
+	go func() {
+		defer close(doneC)
+
+		select {
+		case <-ctx.Done():
+			_ = r.SetReadDeadline(time.Unix(1, 0))
+		case <-stopC:
+		}
+	}()
+
+	_, err = io.Copy(io.Discard, r)
+	close(stopC)
+	<-doneC
+
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// defaultBarrierTimeout bounds the barrier sent by Close for a Notifier
+// configured with WithFlushOnClose but no write timeout.
+const defaultBarrierTimeout = 5 * time.Second
+
+// closeBarrier waits for systemd to process all notifications before Close.
+func (n *Notifier) closeBarrier() error {
+	timeout := n.timeout
+	if timeout <= 0 {
+		timeout = defaultBarrierTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Notifiers which cannot pass file descriptors to systemd have no barrier
+	// to wait for.
+	err := n.Barrier(ctx)
+	if err != nil && !errors.Is(err, errNoControl) && !errors.Is(err, errJournal) {
+		return err
+	}
+
+	return nil
+}
+
+// ReadyAndWait sends a Ready notification and then uses Barrier to block until
+// systemd has processed it, or until ctx is canceled.
+//
+// Notify only guarantees that a notification has been queued on the socket. A
+// short-lived process which exits immediately after Notify may be gone before
+// systemd reads the notification, in which case systemd cannot attribute it to
+// the service and never considers the service ready. When ReadyAndWait returns
+// nil, systemd has already processed the Ready notification. If n is nil or
+// Disabled, ReadyAndWait is a no-op.
+func (n *Notifier) ReadyAndWait(ctx context.Context) error {
+	if err := n.NotifyContext(ctx, Ready); err != nil {
+		return err
+	}
+
+	return n.Barrier(ctx)
+}
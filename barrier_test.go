@@ -0,0 +1,93 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+	"golang.org/x/sys/unix"
+)
+
+func TestNotifierBarrier(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	// Act as systemd by closing the received pipe descriptor after reading the
+	// barrier notification.
+	errC := make(chan error, 1)
+	go func() {
+		errC <- n.Barrier(context.Background())
+	}()
+
+	s, fds := readRights(t, pc)
+	if diff := cmp.Diff("BARRIER=1", s); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+	if len(fds) != 1 {
+		t.Fatalf("expected 1 file descriptor, but got %d", len(fds))
+	}
+
+	select {
+	case err := <-errC:
+		t.Fatalf("barrier returned early: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_ = unix.Close(fds[0])
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to wait for barrier: %v", err)
+	}
+}
+
+func TestNotifierBarrierTimeout(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- n.Barrier(ctx)
+	}()
+
+	// Hold the pipe descriptor open until the barrier gives up.
+	_, fds := readRights(t, pc)
+	defer func() {
+		for _, fd := range fds {
+			_ = unix.Close(fd)
+		}
+	}()
+
+	if err := <-errC; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+}
+
+func TestNotifierReadyAndWait(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- n.ReadyAndWait(context.Background())
+	}()
+
+	if diff := cmp.Diff(sdnotify.Ready, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	s, fds := readRights(t, pc)
+	if diff := cmp.Diff("BARRIER=1", s); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	for _, fd := range fds {
+		_ = unix.Close(fd)
+	}
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to wait for ready: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package sdnotify
+
+import (
+	"context"
+	"strings"
+)
+
+// WithBuffering configures a Notifier to buffer notifications passed to
+// Notify until Flush is called, so that many rapid updates can be sent in a
+// single datagram. Buffered STATUS notifications are coalesced so that only
+// the most recent is sent, since systemd only reports the latest STATUS.
+//
+// Notifications which change the service's state or must meet a deadline are
+// never delayed: if a call to Notify includes READY, RELOADING, STOPPING,
+// WATCHDOG, or EXTEND_TIMEOUT_USEC, the buffered notifications and those of
+// the call are sent together immediately.
+func WithBuffering(buffer bool) Option {
+	return func(n *Notifier) { n.buffered = buffer }
+}
+
+// Flush sends any notifications buffered by a Notifier configured with
+// WithBuffering in a single datagram. If n is nil or Disabled, or no
+// notifications are buffered, Flush is a no-op.
+func (n *Notifier) Flush() error {
+	if n.disabled() {
+		return nil
+	}
+	if n.parent != nil {
+		return n.parent.Flush()
+	}
+
+	n.bufMu.Lock()
+	ss := n.buf
+	n.buf = nil
+	n.bufMu.Unlock()
+
+	if len(ss) == 0 {
+		return nil
+	}
+
+	return n.notify(context.Background(), ss)
+}
+
+// buffer adds the validated notifications in s to the buffer, and sends the
+// buffer immediately if s contains a notification which must not be delayed.
+func (n *Notifier) buffer(ctx context.Context, s []string) error {
+	n.bufMu.Lock()
+
+	var flush bool
+	for _, ss := range s {
+		k, _, _ := strings.Cut(ss, "=")
+		switch k {
+		case "STATUS":
+			// Only the latest status is meaningful.
+			n.buf = removeKey(n.buf, k)
+		case "READY", "RELOADING", "STOPPING", "WATCHDOG", "EXTEND_TIMEOUT_USEC":
+			flush = true
+		}
+
+		n.buf = append(n.buf, ss)
+	}
+
+	if !flush {
+		n.bufMu.Unlock()
+		return nil
+	}
+
+	ss := n.buf
+	n.buf = nil
+	n.bufMu.Unlock()
+
+	return n.notify(ctx, ss)
+}
+
+// removeKey removes any notifications with key k from ss.
+func removeKey(ss []string, k string) []string {
+	out := ss[:0]
+	for _, s := range ss {
+		if !strings.HasPrefix(s, k+"=") {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,54 @@
+package sdnotify_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestWithBuffering(t *testing.T) {
+	var buf bytes.Buffer
+	n := sdnotify.OpenWriter(&buf, sdnotify.WithBuffering(true))
+
+	for _, s := range []string{"loading", "loaded"} {
+		if err := n.Notify(sdnotify.Statusf("%s", s), "X_PROGRESS="+s); err != nil {
+			t.Fatalf("failed to notify: %v", err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected buffered notifications, but got: %q", buf.String())
+	}
+
+	if err := n.Flush(); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+
+	// Only the latest STATUS is kept, and the flush is a single write.
+	const flushed = "X_PROGRESS=loading\nSTATUS=loaded\nX_PROGRESS=loaded\n"
+	if diff := cmp.Diff(flushed, buf.String()); diff != "" {
+		t.Fatalf("unexpected flushed notifications (-want +got):\n%s", diff)
+	}
+	buf.Reset()
+
+	if err := n.Flush(); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected no notifications, but got: %q", buf.String())
+	}
+
+	// READY is never buffered and sends any pending notifications with it.
+	if err := n.Notify(sdnotify.Statusf("starting")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := n.Ready("started"); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	const ready = "STATUS=started\nREADY=1\n"
+	if diff := cmp.Diff(ready, buf.String()); diff != "" {
+		t.Fatalf("unexpected ready notifications (-want +got):\n%s", diff)
+	}
+}
@@ -4,6 +4,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/mdlayher/sdnotify"
 )
@@ -17,6 +18,9 @@ func main() {
 	}
 	defer n.Close()
 
+	// Mirror all notifications to stdout.
+	n = sdnotify.Multi(n, sdnotify.OpenWriter(os.Stdout))
+
 	for i := 0; i < 3; i++ {
 		out(n, sdnotify.Statusf("waiting %d", i))
 	}
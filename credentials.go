@@ -0,0 +1,35 @@
+package sdnotify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Credentials returns the directory which holds the service's credentials, as
+// described in https://systemd.io/CREDENTIALS/. If the CREDENTIALS_DIRECTORY
+// environment variable is unset or empty (meaning systemd passed the service
+// no credentials), Credentials returns false.
+func Credentials() (string, bool) {
+	dir := os.Getenv(CredentialsDirectory)
+	return dir, dir != ""
+}
+
+// Credential reads the contents of the credential specified by name from the
+// directory reported by Credentials. If no credentials directory is present or
+// the credential does not exist, Credential returns an error which can be
+// checked with 'errors.Is(err, os.ErrNotExist)'. An error is returned if name
+// is not a valid credential name, such as one which contains a '/'.
+func Credential(name string) ([]byte, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+		return nil, fmt.Errorf("sdnotify: invalid credential name %q", name)
+	}
+
+	dir, ok := Credentials()
+	if !ok {
+		return nil, fmt.Errorf("sdnotify: no credentials directory: %w", os.ErrNotExist)
+	}
+
+	return os.ReadFile(filepath.Join(dir, name))
+}
@@ -0,0 +1,57 @@
+package sdnotify_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestCredential(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("secret"), 0o600); err != nil {
+		t.Fatalf("failed to write credential: %v", err)
+	}
+
+	t.Setenv(sdnotify.CredentialsDirectory, dir)
+
+	got, ok := sdnotify.Credentials()
+	if !ok {
+		t.Fatal("expected credentials directory")
+	}
+	if diff := cmp.Diff(dir, got); diff != "" {
+		t.Fatalf("unexpected credentials directory (-want +got):\n%s", diff)
+	}
+
+	b, err := sdnotify.Credential("token")
+	if err != nil {
+		t.Fatalf("failed to read credential: %v", err)
+	}
+	if diff := cmp.Diff("secret", string(b)); diff != "" {
+		t.Fatalf("unexpected credential (-want +got):\n%s", diff)
+	}
+
+	if _, err := sdnotify.Credential("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist, but got: %v", err)
+	}
+
+	for _, name := range []string{"", ".", "..", "../token", "a/b", "a\x00b"} {
+		if _, err := sdnotify.Credential(name); err == nil {
+			t.Fatalf("expected error for credential name %q", name)
+		}
+	}
+}
+
+func TestCredentialNoDirectory(t *testing.T) {
+	t.Setenv(sdnotify.CredentialsDirectory, "")
+
+	if _, ok := sdnotify.Credentials(); ok {
+		t.Fatal("expected no credentials directory")
+	}
+	if _, err := sdnotify.Credential("token"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist, but got: %v", err)
+	}
+}
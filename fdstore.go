@@ -0,0 +1,153 @@
+package sdnotify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Store sends a FDSTORE notification which passes fds to systemd for storage
+// in the service's file descriptor store, as described in
+// https://www.freedesktop.org/software/systemd/man/sd_pid_notify_with_fds.html.
+// Stored file descriptors are passed back to the service when it is restarted,
+// and the service must set FileDescriptorStoreMax= in its unit for systemd to
+// accept them.
+//
+// Unlike most other Notifier methods, Store returns an error which can be
+// checked with 'errors.Is(err, os.ErrNotExist)' if n is nil or Disabled, so
+// that callers do not assume their file descriptors were stored. If no files
+// are specified, Store is a no-op.
+func (n *Notifier) Store(fds ...*os.File) error {
+	return n.StoreNamed("", fds...)
+}
+
+// StoreNamed is like Store, but also sends a FDNAME notification so that the
+// stored file descriptors will be identified by name when they are passed back
+// to the service. If name is empty, StoreNamed is equivalent to Store.
+func (n *Notifier) StoreNamed(name string, fds ...*os.File) error {
+	if n.disabled() {
+		return fmt.Errorf("sdnotify: cannot store file descriptors: %w", os.ErrNotExist)
+	}
+	if len(fds) == 0 {
+		return nil
+	}
+
+	s := "FDSTORE=1"
+	if name != "" {
+		fdn, err := FDName(name)
+		if err != nil {
+			return err
+		}
+
+		s += "\n" + fdn
+	}
+
+	raw, err := rawFDs(fds)
+	if err != nil {
+		return err
+	}
+
+	err = n.writeRights(s, raw)
+	runtime.KeepAlive(fds)
+	return err
+}
+
+// RemoveStored sends a FDSTOREREMOVE notification which removes all file
+// descriptors stored under name from the service's file descriptor store.
+//
+// Like Store, RemoveStored returns an error which can be checked with
+// 'errors.Is(err, os.ErrNotExist)' if n is nil or Disabled.
+func (n *Notifier) RemoveStored(name string) error {
+	if n.disabled() {
+		return fmt.Errorf("sdnotify: cannot remove stored file descriptors: %w", os.ErrNotExist)
+	}
+
+	fdn, err := FDName(name)
+	if err != nil {
+		return err
+	}
+
+	return n.Notify("FDSTOREREMOVE=1", fdn)
+}
+
+// FDName creates a FDNAME notification which names the file descriptors stored
+// by a FDSTORE notification. Names must be at most 255 printable ASCII
+// characters and must not contain colons; FDName returns an error otherwise.
+func FDName(name string) (string, error) {
+	if err := validFDName(name); err != nil {
+		return "", err
+	}
+
+	return "FDNAME=" + name, nil
+}
+
+// validFDName reports whether name is a valid file descriptor name, matching
+// the rules of systemd's fdname_is_valid.
+func validFDName(name string) error {
+	if name == "" || len(name) > 255 {
+		return fmt.Errorf("sdnotify: invalid file descriptor name length %d", len(name))
+	}
+
+	for _, r := range name {
+		if r < ' ' || r > '~' || r == ':' {
+			return fmt.Errorf("sdnotify: invalid character %q in file descriptor name %q", r, name)
+		}
+	}
+
+	return nil
+}
+
+// rawFDs returns the file descriptors for fds. Unlike os.File.Fd, it does not
+// change the files to blocking mode. The caller must keep fds alive while the
+// descriptors are in use.
+func rawFDs(fds []*os.File) ([]int, error) {
+	raw := make([]int, 0, len(fds))
+	for _, f := range fds {
+		rc, err := f.SyscallConn()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := rc.Control(func(fd uintptr) {
+			raw = append(raw, int(fd))
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return raw, nil
+}
+
+// writeRights writes s to the socket with file descriptors fds passed as
+// SCM_RIGHTS ancillary data.
+func (n *Notifier) writeRights(s string, fds []int) error {
+	if n.parent != nil {
+		return n.parent.writeRights(s, fds)
+	}
+	if n.multi != nil {
+		return n.forEach(func(mn *Notifier) error { return mn.writeRights(s, fds) })
+	}
+	if n.journal {
+		return errJournal
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ctx := context.Background()
+	oob, err := rightsOOB(fds)
+	if err != nil {
+		return err
+	}
+
+	err = n.sendRetry(ctx, []byte(s), oob)
+	n.logSent(ctx, []byte(s), err)
+	n.observe([]byte(s), err)
+	if err == nil {
+		n.setLast(strings.Split(s, "\n"))
+	}
+
+	return err
+}
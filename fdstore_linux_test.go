@@ -0,0 +1,132 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/unix"
+)
+
+func TestNotifierRemoveStored(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	if err := n.RemoveStored("bad:name"); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	if err := n.RemoveStored("http"); err != nil {
+		t.Fatalf("failed to remove: %v", err)
+	}
+
+	if diff := cmp.Diff("FDSTOREREMOVE=1\nFDNAME=http", readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifierStoreNamed(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	if err := n.StoreNamed("bad:name", os.Stdin); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	if err := n.StoreNamed("http", os.Stdin); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	s, fds := readRights(t, pc)
+	for _, fd := range fds {
+		_ = unix.Close(fd)
+	}
+
+	if diff := cmp.Diff("FDSTORE=1\nFDNAME=http", s); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+	if len(fds) != 1 {
+		t.Fatalf("expected 1 file descriptor, but got %d", len(fds))
+	}
+}
+
+func TestNotifierStore(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if err := n.Store(w); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	// Store must leave the file in non-blocking mode so deadlines still work.
+	if err := w.SetWriteDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline after store: %v", err)
+	}
+
+	s, fds := readRights(t, pc)
+	if diff := cmp.Diff("FDSTORE=1", s); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+	if len(fds) != 1 {
+		t.Fatalf("expected 1 file descriptor, but got %d", len(fds))
+	}
+
+	// Writes to the received descriptor must arrive on the original pipe.
+	f := os.NewFile(uintptr(fds[0]), "stored")
+	defer f.Close()
+
+	const msg = "hello"
+	if _, err := io.WriteString(f, msg); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	_ = w.Close()
+	_ = f.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff(msg, string(b)); diff != "" {
+		t.Fatalf("unexpected pipe contents (-want +got):\n%s", diff)
+	}
+}
+
+// readRights reads a single datagram and any SCM_RIGHTS file descriptors from
+// pc.
+func readRights(t *testing.T, pc net.PacketConn) (string, []int) {
+	t.Helper()
+
+	b := make([]byte, 128)
+	oob := make([]byte, unix.CmsgSpace(4*8))
+	n, oobn, _, _, err := pc.(*net.UnixConn).ReadMsgUnix(b, oob)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	scms, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		t.Fatalf("failed to parse control messages: %v", err)
+	}
+
+	var fds []int
+	for _, scm := range scms {
+		rights, err := unix.ParseUnixRights(&scm)
+		if err != nil {
+			t.Fatalf("failed to parse rights: %v", err)
+		}
+
+		fds = append(fds, rights...)
+	}
+
+	return string(b[:n]), fds
+}
@@ -0,0 +1,58 @@
+package sdnotify_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierStoreNotExist(t *testing.T) {
+	for _, n := range []*sdnotify.Notifier{nil, sdnotify.Disabled()} {
+		if err := n.Store(os.Stdin); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected is not exist, but got: %v", err)
+		}
+		if err := n.RemoveStored("http"); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected is not exist, but got: %v", err)
+		}
+	}
+}
+
+func TestFDName(t *testing.T) {
+	tests := []struct {
+		name, fdname string
+		ok           bool
+	}{
+		{name: "empty"},
+		{name: "too long", fdname: strings.Repeat("a", 256)},
+		{name: "colon", fdname: "http:8080"},
+		{name: "newline", fdname: "http\n"},
+		{name: "control", fdname: "http\x00"},
+		{name: "non-ASCII", fdname: "hëllo"},
+		{name: "OK", fdname: "http", ok: true},
+		{name: "OK max length", fdname: strings.Repeat("a", 255), ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := sdnotify.FDName(tt.fdname)
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to create name: %v", err)
+			}
+
+			if diff := cmp.Diff("FDNAME="+tt.fdname, s); diff != "" {
+				t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package sdnotify
+
+import "strconv"
+
+// Features describes the notification features which the service manager is
+// likely to support, as reported by Notifier.Supports.
+type Features struct {
+	// Watchdog reports whether the service manager expects Watchdog
+	// notifications. See WatchdogEnabled.
+	Watchdog bool
+
+	// Barrier reports whether the service manager is likely to support
+	// Notifier.Barrier, which was added in systemd v246.
+	Barrier bool
+
+	// FDStore reports whether the service has a file descriptor store which
+	// can hold descriptors sent by Notifier.Store.
+	FDStore bool
+}
+
+// Supports makes a best-effort guess at the notification features supported
+// by the service manager. If n was created by NewFromEnv, its environment is
+// used in place of the process environment.
+//
+// systemd does not advertise its version to services, so Supports relies on
+// heuristics: for example, SYSTEMD_EXEC_PID (systemd v248+) implies Barrier
+// support and FDSTORE (systemd v254+) reports the size of the file descriptor
+// store. A false value does not guarantee that a feature is unsupported.
+// MONOTONIC_USEC is not reported because systemd versions which do not require
+// it alongside Reloading ignore it.
+//
+// If n is nil or Disabled, Supports returns the zero value.
+func (n *Notifier) Supports() Features {
+	if n.disabled() {
+		return Features{}
+	}
+
+	_, watchdog, _ := watchdogEnabled(n.getenv)
+	fds, _ := strconv.Atoi(n.getenv(FDStore))
+
+	return Features{
+		Watchdog: watchdog,
+		Barrier:  n.getenv(ExecPID) != "",
+		FDStore:  fds > 0,
+	}
+}
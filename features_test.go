@@ -0,0 +1,70 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierSupports(t *testing.T) {
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want sdnotify.Features
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "all",
+			env: map[string]string{
+				sdnotify.WatchdogUsec: "1000000",
+				sdnotify.ExecPID:      "1",
+				sdnotify.FDStore:      "16",
+			},
+			want: sdnotify.Features{
+				Watchdog: true,
+				Barrier:  true,
+				FDStore:  true,
+			},
+		},
+		{
+			name: "empty fd store",
+			env:  map[string]string{sdnotify.FDStore: "0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{sdnotify.Socket: pc.LocalAddr().String()}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+
+			n, err := sdnotify.NewFromEnv(func(key string) string { return env[key] })
+			if err != nil {
+				t.Fatalf("failed to create notifier: %v", err)
+			}
+			defer n.Close()
+
+			if diff := cmp.Diff(tt.want, n.Supports()); diff != "" {
+				t.Fatalf("unexpected features (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	var n *sdnotify.Notifier
+	if diff := cmp.Diff(sdnotify.Features{}, n.Supports()); diff != "" {
+		t.Fatalf("unexpected nil features (-want +got):\n%s", diff)
+	}
+}
@@ -1,5 +1,8 @@
 module github.com/mdlayher/sdnotify
 
-go 1.18
+go 1.21
 
-require github.com/google/go-cmp v0.5.7
+require (
+	github.com/google/go-cmp v0.5.7
+	golang.org/x/sys v0.26.0
+)
@@ -0,0 +1,99 @@
+package sdnotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// JournalSocket is the path of the systemd journal's native protocol socket.
+const JournalSocket = "/run/systemd/journal/socket"
+
+// WithJournalFallback configures New and NewFromEnv to fall back to the systemd
+// journal socket at sock when NOTIFY_SOCKET is unset, so that a service which
+// is not running with Type=notify still records its status somewhere visible.
+// If sock is empty, JournalSocket is used. If the journal socket does not exist
+// either, New returns an error which can be checked with
+// 'errors.Is(err, os.ErrNotExist)' as usual.
+//
+// The resulting Notifier sends the value of each STATUS notification as a
+// journal message using the native journal protocol. All other notifications
+// are discarded. Methods which pass file descriptors to systemd, such as Store
+// and Barrier, return an error which can be checked with
+// 'errors.Is(err, os.ErrNotExist)', since there is no service manager to
+// receive them.
+func WithJournalFallback(sock string) Option {
+	return func(n *Notifier) {
+		if sock == "" {
+			sock = JournalSocket
+		}
+
+		n.journalFallback = sock
+	}
+}
+
+// errJournal is returned when file descriptors cannot be passed to systemd
+// because a Notifier fell back to the journal.
+var errJournal = fmt.Errorf("sdnotify: journal fallback cannot pass file descriptors to systemd: %w", os.ErrNotExist)
+
+// openJournal creates a Notifier which forwards STATUS notifications to the
+// journal socket sock.
+func openJournal(sock string, opts []Option) (*Notifier, error) {
+	c, _, err := dial(context.Background(), "unixgram", sock)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Notifier{
+		wc:      c,
+		journal: true,
+	}
+
+	return n.apply(opts), nil
+}
+
+// notifyJournal sends a journal message for each STATUS notification in s.
+func (n *Notifier) notifyJournal(ctx context.Context, s []string) error {
+	ident := filepath.Base(os.Args[0])
+	for _, ss := range s {
+		status, ok := strings.CutPrefix(ss, "STATUS=")
+		if !ok {
+			continue
+		}
+
+		var b bytes.Buffer
+		appendJournalField(&b, "MESSAGE", status)
+		appendJournalField(&b, "PRIORITY", "6")
+		appendJournalField(&b, "SYSLOG_IDENTIFIER", ident)
+
+		err := n.write(ctx, b.Bytes())
+		n.logSent(ctx, b.Bytes(), err)
+		n.observe(b.Bytes(), err)
+		if err != nil {
+			return err
+		}
+	}
+
+	n.mu.Lock()
+	n.setLast(s)
+	n.mu.Unlock()
+
+	return nil
+}
+
+// appendJournalField appends the journal field k=v to b. Values which contain
+// a newline use the protocol's length-prefixed binary encoding.
+func appendJournalField(b *bytes.Buffer, k, v string) {
+	if !strings.Contains(v, "\n") {
+		b.WriteString(k + "=" + v + "\n")
+		return
+	}
+
+	b.WriteString(k + "\n")
+	_ = binary.Write(b, binary.LittleEndian, uint64(len(v)))
+	b.WriteString(v + "\n")
+}
@@ -0,0 +1,99 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestWithJournalFallback(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "journal.sock")
+	pc, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	t.Setenv(sdnotify.Socket, "")
+	n, err := sdnotify.New(sdnotify.WithJournalFallback(sock))
+	if err != nil {
+		t.Fatalf("failed to create Notifier: %v", err)
+	}
+	defer n.Close()
+
+	// Notifications other than STATUS are discarded, so the first message
+	// received must be for the status.
+	if err := n.Notify(sdnotify.Watchdog); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := n.Ready("started"); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	want := "MESSAGE=started\nPRIORITY=6\nSYSLOG_IDENTIFIER=" + filepath.Base(os.Args[0]) + "\n"
+	if diff := cmp.Diff(want, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected message (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithJournalFallbackFileDescriptors(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "journal.sock")
+	pc, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	n, err := sdnotify.NewFromEnv(
+		func(string) string { return "" },
+		sdnotify.WithJournalFallback(sock),
+		sdnotify.WithFlushOnClose(true),
+	)
+	if err != nil {
+		t.Fatalf("failed to create Notifier: %v", err)
+	}
+
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer f.Close()
+
+	// Nothing can be stored or awaited without a service manager.
+	if err := n.Store(f); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist from Store, but got: %v", err)
+	}
+	if err := n.Barrier(context.Background()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist from Barrier, but got: %v", err)
+	}
+
+	if err := n.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+}
+
+func TestWithJournalFallbackNotExist(t *testing.T) {
+	n, err := sdnotify.NewFromEnv(
+		func(string) string { return "" },
+		sdnotify.WithJournalFallback(filepath.Join(t.TempDir(), "journal.sock")),
+	)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist, but got: %v", err)
+	}
+	if n != nil {
+		t.Fatal("expected nil Notifier")
+	}
+}
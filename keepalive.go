@@ -0,0 +1,142 @@
+package sdnotify
+
+import (
+	"context"
+	"time"
+)
+
+// KeepAlive starts a goroutine which repeatedly sends an ExtendTimeout
+// notification for d until ctx is canceled, so that systemd's startup,
+// runtime, or shutdown timeout never elapses during a long operation. The first
+// notification is sent immediately and each subsequent notification is sent
+// after half of d, well before the previous extension elapses. KeepAlive
+// returns an error if d is not positive.
+//
+// Any errors which occur while sending notifications are sent on the returned
+// channel, which is closed when the goroutine stops. As with StartWatchdog,
+// errors are discarded if the channel is not being received from.
+//
+// If n is nil or Disabled, KeepAlive starts no goroutine and returns a closed
+// channel.
+func (n *Notifier) KeepAlive(ctx context.Context, d time.Duration) (<-chan error, error) {
+	et, err := ExtendTimeout(d)
+	if err != nil {
+		return nil, err
+	}
+
+	errC := make(chan error, 1)
+	if n.disabled() {
+		close(errC)
+		return errC, nil
+	}
+
+	go func() {
+		defer close(errC)
+
+		t := time.NewTicker(d / 2)
+		defer t.Stop()
+
+		for {
+			// Errors caused by canceling ctx are expected.
+			if err := n.NotifyContext(ctx, et); ctx.Err() == nil {
+				n.background(err)
+				if err != nil {
+					select {
+					case errC <- err:
+					default:
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	return errC, nil
+}
+
+// defaultStartupExtension is the ExtendTimeout duration used by StartupContext
+// unless overridden by WithStartupExtension.
+const defaultStartupExtension = 30 * time.Second
+
+// StartupContext returns ctx for use while the service performs lengthy
+// initialization. Until ctx is canceled, or until n sends a Ready or Stopping
+// notification, the Notifier periodically sends ExtendTimeout notifications as
+// with KeepAlive so that systemd does not kill the slow-starting service.
+// Sending Ready or Stopping only stops the extensions: ctx is not canceled, so
+// servers and other work started using it keep running after startup.
+//
+// The extension duration defaults to 30 seconds and may be changed using
+// WithStartupExtension. Errors sending the extensions are discarded. If n is
+// nil or Disabled, StartupContext returns ctx without sending extensions.
+func (n *Notifier) StartupContext(ctx context.Context) context.Context {
+	if n.disabled() {
+		return ctx
+	}
+	if n.parent != nil {
+		return n.parent.StartupContext(ctx)
+	}
+
+	d := n.startupExtension
+	if d <= 0 {
+		d = defaultStartupExtension
+	}
+
+	// Only one startup may be in progress at a time.
+	n.stopStartup()
+
+	kctx, cancel := context.WithCancel(ctx)
+
+	// d is always positive, so KeepAlive cannot fail.
+	errC, _ := n.KeepAlive(kctx, d)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.endStartup = func() {
+		cancel()
+		// Wait for the goroutine to stop so that no extension can follow a
+		// subsequent notification.
+		for range errC {
+		}
+	}
+
+	return ctx
+}
+
+// endsStartup reports whether s contains a Ready or Stopping notification,
+// after which StartupContext must no longer extend the startup timeout.
+func endsStartup(s []string) bool {
+	for _, ss := range s {
+		if ss == Ready || ss == Stopping {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stopStartup stops any extensions started by StartupContext.
+func (n *Notifier) stopStartup() {
+	if n.disabled() {
+		return
+	}
+	if n.parent != nil {
+		n.parent.stopStartup()
+		return
+	}
+
+	// The goroutine must be able to acquire n.mu while it stops.
+	n.mu.Lock()
+	end := n.endStartup
+	n.endStartup = nil
+	n.mu.Unlock()
+
+	if end != nil {
+		end()
+	}
+}
@@ -0,0 +1,165 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierKeepAlive(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errC, err := n.KeepAlive(ctx, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to start keepalive: %v", err)
+	}
+
+	// Expect several extensions before stopping the goroutine.
+	for i := 0; i < 3; i++ {
+		if diff := cmp.Diff("EXTEND_TIMEOUT_USEC=20000", readString(t, pc)); diff != "" {
+			t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+		}
+	}
+
+	cancel()
+	for err := range errC {
+		t.Fatalf("failed to send keepalive notification: %v", err)
+	}
+}
+
+func TestNotifierKeepAliveInvalid(t *testing.T) {
+	n, _ := testNotifier(t)
+
+	if _, err := n.KeepAlive(context.Background(), 0); err == nil {
+		t.Fatal("expected invalid duration error")
+	}
+}
+
+func TestNotifierStartupContext(t *testing.T) {
+	tests := []struct {
+		name  string
+		ready func(n *sdnotify.Notifier) error
+	}{
+		{
+			name:  "Ready",
+			ready: func(n *sdnotify.Notifier) error { return n.Ready("") },
+		},
+		{
+			name:  "Notify",
+			ready: func(n *sdnotify.Notifier) error { return n.Notify(sdnotify.Ready) },
+		},
+		{
+			name:  "NotifyState",
+			ready: func(n *sdnotify.Notifier) error { return n.NotifyState(sdnotify.State{Ready: true}) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc, err := net.ListenPacket("unixgram", "")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer pc.Close()
+
+			if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				t.Fatalf("failed to set deadline: %v", err)
+			}
+
+			n, err := sdnotify.Open(pc.LocalAddr().String(), sdnotify.WithStartupExtension(20*time.Millisecond))
+			if err != nil {
+				t.Fatalf("failed to open: %v", err)
+			}
+			defer n.Close()
+
+			ctx := n.StartupContext(context.Background())
+
+			for i := 0; i < 2; i++ {
+				if diff := cmp.Diff("EXTEND_TIMEOUT_USEC=20000", readString(t, pc)); diff != "" {
+					t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+				}
+			}
+
+			if err := tt.ready(n); err != nil {
+				t.Fatalf("failed to notify: %v", err)
+			}
+
+			// Work started using the context must outlive startup.
+			if err := ctx.Err(); err != nil {
+				t.Fatalf("context canceled by ready: %v", err)
+			}
+
+			// Extensions may have been sent just before Ready, but none may
+			// follow it.
+			for {
+				s := readString(t, pc)
+				if s == sdnotify.Ready {
+					break
+				}
+				if s != "EXTEND_TIMEOUT_USEC=20000" {
+					t.Fatalf("unexpected notification: %q", s)
+				}
+			}
+
+			if err := pc.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+				t.Fatalf("failed to set deadline: %v", err)
+			}
+			if _, _, err := pc.ReadFrom(make([]byte, 64)); !errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatalf("expected no notifications after ready, but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestNotifierKeepAliveWatchdog(t *testing.T) {
+	t.Setenv(sdnotify.WatchdogUsec, strconv.Itoa(int((10 * time.Millisecond).Microseconds())))
+
+	n, pc := testNotifier(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wdC, err := n.StartWatchdog(ctx)
+	if err != nil {
+		t.Fatalf("failed to start watchdog: %v", err)
+	}
+	kaC, err := n.KeepAlive(ctx, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to start keepalive: %v", err)
+	}
+
+	// Every datagram must hold exactly one sender's notification.
+	seen := make(map[string]int)
+	for i := 0; i < 20; i++ {
+		s := readString(t, pc)
+		switch s {
+		case sdnotify.Watchdog, "EXTEND_TIMEOUT_USEC=10000":
+			seen[s]++
+		default:
+			t.Fatalf("unexpected notification: %q", s)
+		}
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected notifications from both senders, but got: %v", seen)
+	}
+
+	cancel()
+	for err := range wdC {
+		t.Fatalf("failed to send watchdog notification: %v", err)
+	}
+	for err := range kaC {
+		t.Fatalf("failed to send keepalive notification: %v", err)
+	}
+}
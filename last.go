@@ -0,0 +1,31 @@
+package sdnotify
+
+import "time"
+
+// LastNotify returns the notifications most recently sent by n and the time at
+// which they were sent, for diagnostic purposes such as a health endpoint which
+// reports the service's status. The notifications sent together in a single
+// call are returned together, in the order they were sent.
+//
+// If n is nil or Disabled, or no notifications have been sent successfully,
+// LastNotify returns nil and the zero time.
+func (n *Notifier) LastNotify() ([]string, time.Time) {
+	if n.disabled() {
+		return nil, time.Time{}
+	}
+	if n.parent != nil {
+		return n.parent.LastNotify()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]string(nil), n.last...), n.lastTime
+}
+
+// setLast records ss as the most recently sent notifications. The caller must
+// hold n.mu.
+func (n *Notifier) setLast(ss []string) {
+	n.last = append(n.last[:0], ss...)
+	n.lastTime = time.Now()
+}
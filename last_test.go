@@ -0,0 +1,41 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierLastNotify(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	if ss, at := n.LastNotify(); ss != nil || !at.IsZero() {
+		t.Fatalf("expected no notifications, but got %q at %s", ss, at)
+	}
+
+	start := time.Now()
+	if err := n.Ready("started"); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	_ = readString(t, pc)
+
+	ss, at := n.LastNotify()
+	if diff := cmp.Diff([]string{"STATUS=started", sdnotify.Ready}, ss); diff != "" {
+		t.Fatalf("unexpected notifications (-want +got):\n%s", diff)
+	}
+	if at.Before(start) {
+		t.Fatalf("unexpected notification time: %s", at)
+	}
+
+	// Invalid notifications are never sent and must not be recorded.
+	if err := n.Notify("foo"); err == nil {
+		t.Fatal("expected invalid notification error")
+	}
+	if ss, _ := n.LastNotify(); len(ss) != 2 {
+		t.Fatalf("unexpected notifications after invalid notify: %q", ss)
+	}
+}
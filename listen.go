@@ -0,0 +1,251 @@
+package sdnotify
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd, following
+// stdin, stdout, and stderr.
+const listenFDsStart = 3
+
+// ListenFDs returns the files passed to the service by systemd through socket
+// activation or the file descriptor store, as described in
+// https://www.freedesktop.org/software/systemd/man/sd_listen_fds.html.
+//
+// If the LISTEN_PID environment variable is unset or specifies a process
+// other than the current process, ListenFDs returns no files. An error is
+// returned if the LISTEN_PID, LISTEN_FDS, or LISTEN_FDNAMES environment
+// variables cannot be parsed.
+//
+// Each returned file takes ownership of its file descriptor, so ListenFDs
+// should only be called once per process.
+func ListenFDs() ([]*os.File, error) {
+	return listenFDs(os.Getenv)
+}
+
+// ListenFDsWithNames is like ListenFDs, but returns the files grouped by the
+// names specified by FileDescriptorName= or FDNAME notifications. Files with
+// no name are grouped under "unknown".
+func ListenFDsWithNames() (map[string][]*os.File, error) {
+	return groupByName(listenFDs(os.Getenv))
+}
+
+// ListenFDs is like the package-level ListenFDs, but reads the socket
+// activation environment variables from n's environment, such as the one
+// passed to NewFromEnv. If n is nil, the process environment is used.
+func (n *Notifier) ListenFDs() ([]*os.File, error) {
+	return listenFDs(n.getenv)
+}
+
+// ListenFDsWithNames is like the package-level ListenFDsWithNames, but reads
+// environment variables from n's environment as with n.ListenFDs.
+func (n *Notifier) ListenFDsWithNames() (map[string][]*os.File, error) {
+	return groupByName(listenFDs(n.getenv))
+}
+
+// groupByName groups files by name for ListenFDsWithNames.
+func groupByName(files []*os.File, err error) (map[string][]*os.File, error) {
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+
+	m := make(map[string][]*os.File, len(files))
+	for _, f := range files {
+		m[f.Name()] = append(m[f.Name()], f)
+	}
+
+	return m, nil
+}
+
+// listenFDs parses the socket activation environment variables read using
+// getenv and returns the passed files, each named using LISTEN_FDNAMES.
+func listenFDs(getenv func(string) string) ([]*os.File, error) {
+	ps := getenv(ListenPID)
+	if ps == "" {
+		return nil, nil
+	}
+
+	pid, err := strconv.Atoi(ps)
+	if err != nil || pid <= 0 {
+		return nil, fmt.Errorf("sdnotify: invalid LISTEN_PID %q", ps)
+	}
+	if pid != os.Getpid() {
+		// The files are intended for another process.
+		return nil, nil
+	}
+
+	fs := getenv(ListenFDCount)
+	nfds, err := strconv.Atoi(fs)
+	if err != nil || nfds < 0 {
+		return nil, fmt.Errorf("sdnotify: invalid LISTEN_FDS %q", fs)
+	}
+	if nfds == 0 {
+		return nil, nil
+	}
+
+	// An empty LISTEN_FDNAMES names a single file no differently than an
+	// unset one, so there is no need to distinguish the two.
+	names := make([]string, nfds)
+	if ns := getenv(ListenFDNames); ns != "" {
+		names = strings.Split(ns, ":")
+		if len(names) != nfds {
+			return nil, fmt.Errorf("sdnotify: LISTEN_FDNAMES %q does not match LISTEN_FDS %d", ns, nfds)
+		}
+	}
+
+	files := make([]*os.File, 0, nfds)
+	for i, name := range names {
+		if name == "" {
+			name = "unknown"
+		}
+
+		fd := listenFDsStart + i
+		if err := prepareListenFD(fd); err != nil {
+			return nil, fmt.Errorf("sdnotify: failed to set file descriptor %d non-blocking: %w", fd, err)
+		}
+
+		files = append(files, os.NewFile(uintptr(fd), name))
+	}
+
+	return files, nil
+}
+
+// Listeners is like ListenFDsWithNames, but converts the passed stream sockets,
+// such as TCP and UNIX listeners, into net.Listener values grouped by name. The
+// passed datagram sockets are available from PacketConns. This allows a
+// service to resume listening on the sockets passed by socket activation or
+// stored in the file descriptor store by an earlier instance.
+//
+// Listeners and PacketConns share a single conversion of the passed
+// descriptors, so both may be called, any number of times, but neither should
+// be combined with ListenFDs or ListenFDsWithNames. An error is returned if any
+// passed descriptor is not a socket.
+func Listeners() (map[string][]net.Listener, error) {
+	s := inherited.get(os.Getenv)
+	return s.listeners, s.err
+}
+
+// PacketConns is like Listeners, but returns the passed datagram sockets, such
+// as UDP and UNIX datagram sockets, as net.PacketConn values grouped by name.
+func PacketConns() (map[string][]net.PacketConn, error) {
+	s := inherited.get(os.Getenv)
+	return s.packetConns, s.err
+}
+
+// Listeners is like the package-level Listeners, but reads environment
+// variables from n's environment as with n.ListenFDs. If n uses the process
+// environment, n.Listeners shares the package-level conversion of the passed
+// descriptors; otherwise, only one Notifier per process should convert them.
+func (n *Notifier) Listeners() (map[string][]net.Listener, error) {
+	s := n.passedSockets()
+	return s.listeners, s.err
+}
+
+// PacketConns is like the package-level PacketConns, but reads environment
+// variables from n's environment as with n.Listeners.
+func (n *Notifier) PacketConns() (map[string][]net.PacketConn, error) {
+	s := n.passedSockets()
+	return s.packetConns, s.err
+}
+
+// passedSockets returns the sockets converted using n's environment.
+func (n *Notifier) passedSockets() *inheritedSockets {
+	switch {
+	case n == nil:
+		return inherited.get(os.Getenv)
+	case n.parent != nil:
+		return n.parent.passedSockets()
+	case n.env == nil:
+		return inherited.get(os.Getenv)
+	}
+
+	return n.sockets.get(n.env)
+}
+
+// inherited holds the sockets converted by Listeners and PacketConns.
+var inherited inheritedSockets
+
+// inheritedSockets converts the passed descriptors into network types once.
+type inheritedSockets struct {
+	once        sync.Once
+	listeners   map[string][]net.Listener
+	packetConns map[string][]net.PacketConn
+	err         error
+}
+
+// get converts the descriptors passed according to getenv on first use and
+// returns s.
+func (s *inheritedSockets) get(getenv func(string) string) *inheritedSockets {
+	s.once.Do(func() { s.convert(getenv) })
+	return s
+}
+
+// convert implements Listeners and PacketConns.
+func (s *inheritedSockets) convert(getenv func(string) string) {
+	files, err := listenFDs(getenv)
+	if err != nil || len(files) == 0 {
+		s.err = err
+		return
+	}
+
+	// The net package duplicates each descriptor, so the passed descriptors
+	// are always closed.
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	ls := make(map[string][]net.Listener)
+	pcs := make(map[string][]net.PacketConn)
+	for i, f := range files {
+		fd := listenFDsStart + i
+		stream, err := isStreamSocket(fd)
+		if err != nil {
+			s.err = fmt.Errorf("sdnotify: passed file descriptor %d (%q) is not a socket: %w", fd, f.Name(), err)
+			break
+		}
+
+		if stream {
+			l, err := net.FileListener(f)
+			if err != nil {
+				s.err = fmt.Errorf("sdnotify: failed to create listener for file descriptor %d (%q): %w", fd, f.Name(), err)
+				break
+			}
+
+			ls[f.Name()] = append(ls[f.Name()], l)
+			continue
+		}
+
+		pc, err := net.FilePacketConn(f)
+		if err != nil {
+			s.err = fmt.Errorf("sdnotify: failed to create packet conn for file descriptor %d (%q): %w", fd, f.Name(), err)
+			break
+		}
+
+		pcs[f.Name()] = append(pcs[f.Name()], pc)
+	}
+
+	if s.err != nil {
+		// Don't leak the sockets converted before the failure.
+		for _, group := range ls {
+			for _, l := range group {
+				_ = l.Close()
+			}
+		}
+		for _, group := range pcs {
+			for _, pc := range group {
+				_ = pc.Close()
+			}
+		}
+
+		return
+	}
+
+	s.listeners, s.packetConns = ls, pcs
+}
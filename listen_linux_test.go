@@ -0,0 +1,191 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+// helperEnv is set when the test binary is re-executed as a helper process.
+const helperEnv = "SDNOTIFY_TEST_HELPER"
+
+func TestListenFDsWithNames(t *testing.T) {
+	if os.Getenv(helperEnv) == "1" {
+		listenFDsHelper()
+		return
+	}
+
+	// Pass several pipes to a child process starting at file descriptor 3, as
+	// systemd would.
+	var (
+		ws    []*os.File
+		extra []*os.File
+	)
+	for i := 0; i < 3; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("failed to create pipe: %v", err)
+		}
+		defer r.Close()
+		defer w.Close()
+
+		ws = append(ws, w)
+		extra = append(extra, r)
+	}
+
+	for i, w := range ws {
+		if _, err := fmt.Fprintf(w, "pipe %d", i); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		_ = w.Close()
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestListenFDsWithNames$")
+	cmd.Env = append(os.Environ(),
+		helperEnv+"=1",
+		"LISTEN_FDS=3",
+		"LISTEN_FDNAMES=http:http:grpc",
+	)
+	cmd.ExtraFiles = extra
+
+	b, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to run helper: %v\nout:\n%s", err, string(b))
+	}
+
+	const want = "grpc: pipe 2\nhttp: pipe 0\nhttp: pipe 1\n"
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Fatalf("unexpected helper output (-want +got):\n%s", diff)
+	}
+}
+
+// listenFDsHelper runs in a child process and prints the names and contents
+// of the files passed by its parent.
+func listenFDsHelper() {
+	// The parent cannot know the child's PID in advance.
+	os.Setenv(sdnotify.ListenPID, strconv.Itoa(os.Getpid()))
+
+	m, err := sdnotify.ListenFDsWithNames()
+	if err != nil {
+		panicf("failed to get files: %v", err)
+	}
+
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, f := range m[name] {
+			b, err := io.ReadAll(f)
+			if err != nil {
+				panicf("failed to read: %v", err)
+			}
+
+			fmt.Printf("%s: %s\n", name, b)
+		}
+	}
+
+	os.Exit(0)
+}
+
+func TestListeners(t *testing.T) {
+	if os.Getenv(helperEnv) == "1" {
+		listenersHelper()
+		return
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	lf, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("failed to get listener file: %v", err)
+	}
+	defer lf.Close()
+
+	pcf, err := pc.(*net.UnixConn).File()
+	if err != nil {
+		t.Fatalf("failed to get packet conn file: %v", err)
+	}
+	defer pcf.Close()
+
+	run := func(names string, extra ...*os.File) string {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestListeners$")
+		cmd.Env = append(os.Environ(),
+			helperEnv+"=1",
+			sdnotify.ListenFDCount+"="+strconv.Itoa(len(extra)),
+			sdnotify.ListenFDNames+"="+names,
+		)
+		cmd.ExtraFiles = extra
+
+		b, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("failed to run helper: %v\nout:\n%s", err, string(b))
+		}
+
+		return string(b)
+	}
+
+	want := fmt.Sprintf("http: tcp %s\ndns: unixgram %s\n", l.Addr(), pc.LocalAddr())
+	if diff := cmp.Diff(want, run("http:dns", lf, pcf)); diff != "" {
+		t.Fatalf("unexpected helper output (-want +got):\n%s", diff)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if got := run("http:pipe", lf, r); !strings.Contains(got, "error: ") || !strings.Contains(got, `"pipe"`) {
+		t.Fatalf("expected not a socket error, but got: %q", got)
+	}
+}
+
+// listenersHelper runs in a child process and prints the addresses of the
+// sockets passed by its parent.
+func listenersHelper() {
+	os.Setenv(sdnotify.ListenPID, strconv.Itoa(os.Getpid()))
+
+	ls, err := sdnotify.Listeners()
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(0)
+	}
+	pcs, err := sdnotify.PacketConns()
+	if err != nil {
+		panicf("failed to get packet conns: %v", err)
+	}
+
+	for _, l := range ls["http"] {
+		fmt.Printf("http: %s %s\n", l.Addr().Network(), l.Addr())
+	}
+	for _, pc := range pcs["dns"] {
+		fmt.Printf("dns: %s %s\n", pc.LocalAddr().Network(), pc.LocalAddr())
+	}
+
+	os.Exit(0)
+}
@@ -0,0 +1,120 @@
+package sdnotify_test
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestListenFDsNotForUs(t *testing.T) {
+	t.Setenv(sdnotify.ListenPID, strconv.Itoa(os.Getpid()+1))
+	t.Setenv(sdnotify.ListenFDCount, "1")
+
+	files, err := sdnotify.ListenFDs()
+	if err != nil {
+		t.Fatalf("failed to get files: %v", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected no files, but got %d", len(files))
+	}
+}
+
+func TestListenFDsInvalid(t *testing.T) {
+	tests := []struct {
+		name, fds, names string
+	}{
+		{name: "bad count", fds: "foo"},
+		{name: "negative count", fds: "-1"},
+		{name: "names mismatch", fds: "2", names: "http"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(sdnotify.ListenPID, strconv.Itoa(os.Getpid()))
+			t.Setenv(sdnotify.ListenFDCount, tt.fds)
+			t.Setenv(sdnotify.ListenFDNames, tt.names)
+
+			if _, err := sdnotify.ListenFDs(); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestNotifierListenFDs(t *testing.T) {
+	// Only the Notifier's environment may pass files.
+	t.Setenv(sdnotify.ListenPID, "")
+
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		name   string
+		env    map[string]string
+		errors bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name: "not for us",
+			env: map[string]string{
+				sdnotify.ListenPID:     strconv.Itoa(os.Getpid() + 1),
+				sdnotify.ListenFDCount: "1",
+			},
+		},
+		{
+			name: "none",
+			env: map[string]string{
+				sdnotify.ListenPID:     pid,
+				sdnotify.ListenFDCount: "0",
+			},
+		},
+		{
+			name: "bad count",
+			env: map[string]string{
+				sdnotify.ListenPID:     pid,
+				sdnotify.ListenFDCount: "foo",
+			},
+			errors: true,
+		},
+		{
+			name: "names mismatch",
+			env: map[string]string{
+				sdnotify.ListenPID:     pid,
+				sdnotify.ListenFDCount: "2",
+				sdnotify.ListenFDNames: "http",
+			},
+			errors: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := sdnotify.NewFromEnv(func(key string) string { return tt.env[key] }, sdnotify.WithDryRun(true))
+			if err != nil {
+				t.Fatalf("failed to create notifier: %v", err)
+			}
+
+			files, err := n.ListenFDs()
+			_, lerr := n.Listeners()
+			_, perr := n.PacketConns()
+
+			if tt.errors {
+				if err == nil || lerr == nil || perr == nil {
+					t.Fatalf("expected errors, but got: %v, %v, %v", err, lerr, perr)
+				}
+
+				return
+			}
+			if err := errors.Join(err, lerr, perr); err != nil {
+				t.Fatalf("failed to get files: %v", err)
+			}
+			if len(files) != 0 {
+				t.Fatalf("expected no files, but got %d", len(files))
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package sdnotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// A Listener receives notifications sent by a service, acting in place of
+// systemd. It is intended for integration tests which start a service with
+// NOTIFY_SOCKET set to the Listener's Addr and wait for it to become ready.
+type Listener struct {
+	c    *net.UnixConn
+	path string
+}
+
+// NewListener creates a Listener which receives notifications on a unixgram
+// socket created at path. Path must not already exist.
+func NewListener(path string) (*Listener, error) {
+	c, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Listener{c: c, path: path}, nil
+}
+
+// Addr returns the Listener's socket path, suitable for use as the value of
+// NOTIFY_SOCKET.
+func (l *Listener) Addr() string { return l.path }
+
+// Close closes the Listener's socket and removes its socket file.
+func (l *Listener) Close() error {
+	err := l.c.Close()
+	if rerr := os.Remove(l.path); rerr != nil && !errors.Is(rerr, os.ErrNotExist) && err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// Next blocks until the Listener receives a datagram and returns the State
+// described by its notifications, or until ctx is canceled. Notifications
+// which State cannot represent are ignored. If ctx is canceled or its deadline
+// is exceeded before a datagram arrives, Next returns ctx.Err().
+//
+// If a datagram is too large to receive whole, Next discards it and returns an
+// error which wraps syscall.EMSGSIZE rather than parsing a truncated datagram.
+func (l *Listener) Next(ctx context.Context) (State, error) {
+	if err := ctx.Err(); err != nil {
+		return State{}, err
+	}
+
+	if d, ok := ctx.Deadline(); ok {
+		if err := l.c.SetReadDeadline(d); err != nil {
+			return State{}, err
+		}
+	}
+
+	// Interrupt a blocked read immediately if ctx is canceled.
+	var (
+		stopC = make(chan struct{})
+		doneC = make(chan struct{})
+	)
+
+	go func() {
+		defer close(doneC)
+
+		select {
+		case <-ctx.Done():
+			_ = l.c.SetReadDeadline(time.Unix(1, 0))
+		case <-stopC:
+		}
+	}()
+
+	// systemd accepts datagrams of up to maxDatagram bytes, but leave room to
+	// receive larger ones from misbehaving services.
+	b := make([]byte, 16*maxDatagram)
+	n, _, flags, _, err := l.c.ReadMsgUnix(b, nil)
+	close(stopC)
+	<-doneC
+
+	// Clear the deadline for future reads.
+	if derr := l.c.SetReadDeadline(time.Time{}); err == nil {
+		err = derr
+	}
+
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		<-ctx.Done()
+		return State{}, ctx.Err()
+	}
+	if err != nil {
+		return State{}, err
+	}
+	if flags&msgTrunc != 0 {
+		// Never parse part of a datagram.
+		return State{}, fmt.Errorf("sdnotify: received datagram exceeds %d byte buffer: %w",
+			len(b), syscall.EMSGSIZE)
+	}
+
+	var s State
+	if err := s.UnmarshalText(b[:n]); err != nil {
+		return State{}, err
+	}
+
+	return s, nil
+}
+
+// EchoServer starts a Listener on a socket in a new temporary directory and
+// sends the State parsed from each datagram it receives on the returned channel
+// until ctx is canceled. It is useful for tests and debugging tools which set
+// NOTIFY_SOCKET to the returned addr and observe a service's notifications.
+//
+// Malformed datagrams are discarded. When ctx is canceled, EchoServer closes
+// the Listener, removes the temporary directory, and closes the channel.
+func EchoServer(ctx context.Context) (addr string, received <-chan State, err error) {
+	dir, err := os.MkdirTemp("", "sdnotify")
+	if err != nil {
+		return "", nil, err
+	}
+
+	l, err := NewListener(filepath.Join(dir, "notify.sock"))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	stateC := make(chan State)
+	go func() {
+		defer func() {
+			_ = l.Close()
+			_ = os.RemoveAll(dir)
+			close(stateC)
+		}()
+
+		for {
+			s, err := l.Next(ctx)
+			if err != nil {
+				var oerr *net.OpError
+				if ctx.Err() != nil || errors.As(err, &oerr) {
+					// Canceled or the socket failed.
+					return
+				}
+
+				// Malformed datagram.
+				continue
+			}
+
+			select {
+			case stateC <- s:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return l.Addr(), stateC, nil
+}
@@ -0,0 +1,158 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestListenerNext(t *testing.T) {
+	l, err := sdnotify.NewListener(filepath.Join(t.TempDir(), "notify.sock"))
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	n, err := sdnotify.Open(l.Addr())
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer n.Close()
+
+	var (
+		errno = 5
+		pid   = 1
+		d     = 5 * time.Second
+	)
+
+	want := sdnotify.State{
+		Status:        "reloading",
+		Errno:         &errno,
+		MainPID:       &pid,
+		ExtendTimeout: &d,
+		Watchdog:      true,
+		Reloading:     true,
+		Ready:         true,
+		Stopping:      true,
+	}
+
+	if err := n.NotifyState(want); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	got, err := l.Next(ctx)
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected state (-want +got):\n%s", diff)
+	}
+}
+
+func TestListenerNextTimeout(t *testing.T) {
+	l, err := sdnotify.NewListener(filepath.Join(t.TempDir(), "notify.sock"))
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := l.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+}
+
+func TestEchoServer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addr, stateC, err := sdnotify.EchoServer(ctx)
+	if err != nil {
+		t.Fatalf("failed to start echo server: %v", err)
+	}
+
+	n, err := sdnotify.Open(addr)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer n.Close()
+
+	// The malformed datagram must be skipped.
+	if err := n.NotifyRaw("malformed"); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := n.Ready("started"); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	want := sdnotify.State{Status: "started", Ready: true}
+	if diff := cmp.Diff(want, <-stateC); diff != "" {
+		t.Fatalf("unexpected state (-want +got):\n%s", diff)
+	}
+
+	// Canceling ctx stops the server and closes the channel.
+	cancel()
+	for range stateC {
+	}
+
+	if _, err := os.Stat(addr); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected socket to be removed, but got: %v", err)
+	}
+}
+
+func TestListenerNextTruncated(t *testing.T) {
+	l, err := sdnotify.NewListener(filepath.Join(t.TempDir(), "notify.sock"))
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	c, err := net.Dial("unixgram", l.Addr())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	// Send a datagram larger than Next's buffer, but which ends with a
+	// notification that would parse if it were truncated.
+	big := "STATUS=" + strings.Repeat("a", 64*1024) + "\n" + sdnotify.Ready
+	if _, err := c.Write([]byte(big)); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if _, err := c.Write([]byte(sdnotify.Stopping)); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := l.Next(ctx); !errors.Is(err, syscall.EMSGSIZE) {
+		t.Fatalf("expected EMSGSIZE, but got: %v", err)
+	}
+
+	// The truncated datagram is discarded and the next is received intact.
+	got, err := l.Next(ctx)
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if diff := cmp.Diff(sdnotify.State{Stopping: true}, got); diff != "" {
+		t.Fatalf("unexpected state (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,56 @@
+package sdnotify
+
+import (
+	"context"
+	"errors"
+)
+
+// Multi creates a Notifier which forwards every notification to each of the
+// input Notifiers, such as a systemd socket and an OpenWriter debug sink. Nil
+// and Disabled Notifiers are ignored. Each input Notifier sends notifications
+// using its own configuration, such as WithStatusPrefix or WithJournalFallback.
+//
+// An error from one Notifier does not prevent notifications from being sent to
+// the others; all errors are combined using errors.Join. Closing the returned
+// Notifier closes each of the input Notifiers.
+func Multi(notifiers ...*Notifier) *Notifier {
+	ns := make([]*Notifier, 0, len(notifiers))
+	for _, n := range notifiers {
+		if !n.disabled() {
+			ns = append(ns, n)
+		}
+	}
+
+	if len(ns) == 0 {
+		return Disabled()
+	}
+
+	return &Notifier{multi: ns}
+}
+
+// forEach calls fn for each Notifier wrapped by a Multi Notifier and joins
+// any resulting errors.
+func (n *Notifier) forEach(fn func(n *Notifier) error) error {
+	var errs []error
+	for _, mn := range n.multi {
+		if err := fn(mn); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// notifyMulti sends the notifications in s through each Notifier wrapped by a
+// Multi Notifier, so that each applies its own configuration.
+func (n *Notifier) notifyMulti(ctx context.Context, s []string) error {
+	if err := n.forEach(func(mn *Notifier) error { return mn.notify(ctx, s) }); err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	n.setLast(s)
+	n.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,102 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestMulti(t *testing.T) {
+	sock, pc := testNotifier(t)
+
+	var buf bytes.Buffer
+	n := sdnotify.Multi(nil, sock, sdnotify.Disabled(), sdnotify.OpenWriter(&buf))
+
+	ss := []string{sdnotify.Statusf("started"), sdnotify.Ready}
+	if err := n.Notify(ss...); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	if diff := cmp.Diff(ss, strings.Split(readString(t, pc), "\n")); diff != "" {
+		t.Fatalf("unexpected socket notification (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("STATUS=started\nREADY=1\n", buf.String()); diff != "" {
+		t.Fatalf("unexpected writer notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestMultiJournalFallback(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "journal.sock")
+	pc, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	jn, err := sdnotify.NewFromEnv(
+		func(string) string { return "" },
+		sdnotify.WithJournalFallback(sock),
+	)
+	if err != nil {
+		t.Fatalf("failed to create Notifier: %v", err)
+	}
+
+	n := sdnotify.Multi(jn)
+	defer n.Close()
+
+	if err := n.Notify(sdnotify.Ready, sdnotify.Statusf("started")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	want := "MESSAGE=started\nPRIORITY=6\nSYSLOG_IDENTIFIER=" + filepath.Base(os.Args[0]) + "\n"
+	if diff := cmp.Diff(want, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected message (-want +got):\n%s", diff)
+	}
+}
+
+func TestMultiSeparateDatagrams(t *testing.T) {
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	sn, err := sdnotify.Open(pc.LocalAddr().String(), sdnotify.WithSeparateDatagrams(true))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	n := sdnotify.Multi(sn)
+	defer n.Close()
+
+	want := []string{"STATUS=started", sdnotify.Ready}
+	if err := n.Notify(want...); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	var got []string
+	for range want {
+		got = append(got, readString(t, pc))
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected datagrams (-want +got):\n%s", diff)
+	}
+}
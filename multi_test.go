@@ -0,0 +1,93 @@
+package sdnotify_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestMultiScoped(t *testing.T) {
+	var buf bytes.Buffer
+	n := sdnotify.Multi(sdnotify.OpenWriter(&buf).Scoped("db: "))
+
+	if err := n.Notify(sdnotify.Statusf("x")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	if diff := cmp.Diff("STATUS=db: x\n", buf.String()); diff != "" {
+		t.Fatalf("unexpected writer notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestMultiStatusPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	n := sdnotify.Multi(sdnotify.OpenWriter(&buf, sdnotify.WithStatusPrefix("x: ")))
+
+	if err := n.Notify(sdnotify.Statusf("hi")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	if diff := cmp.Diff("STATUS=x: hi\n", buf.String()); diff != "" {
+		t.Fatalf("unexpected writer notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestMultiLastNotify(t *testing.T) {
+	var buf bytes.Buffer
+	wn := sdnotify.OpenWriter(&buf)
+	n := sdnotify.Multi(wn)
+
+	ss := []string{sdnotify.Statusf("started"), sdnotify.Ready}
+	if err := n.Notify(ss...); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	for _, nn := range []*sdnotify.Notifier{n, wn} {
+		got, _ := nn.LastNotify()
+		if diff := cmp.Diff(ss, got); diff != "" {
+			t.Fatalf("unexpected last notification (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestMultiErrors(t *testing.T) {
+	var (
+		errA = errors.New("A")
+		errB = errors.New("B")
+		buf  bytes.Buffer
+	)
+
+	n := sdnotify.Multi(
+		sdnotify.OpenWriter(errWriter{errA}),
+		sdnotify.OpenWriter(&buf),
+		sdnotify.OpenWriter(errWriter{errB}),
+	)
+
+	// Both errors are reported and the healthy sink still receives the
+	// notification.
+	err := n.Notify(sdnotify.Ready)
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Fatalf("expected joined errors, but got: %v", err)
+	}
+	if diff := cmp.Diff("READY=1\n", buf.String()); diff != "" {
+		t.Fatalf("unexpected writer notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestMultiEmpty(t *testing.T) {
+	n := sdnotify.Multi(nil, sdnotify.Disabled())
+	if err := n.Notify(sdnotify.Ready); err != nil {
+		t.Fatalf("failed to noop notify: %v", err)
+	}
+	if err := n.Close(); err != nil {
+		t.Fatalf("failed to noop close: %v", err)
+	}
+}
+
+// An errWriter is an io.Writer which always returns err.
+type errWriter struct{ err error }
+
+func (w errWriter) Write(_ []byte) (int, error) { return 0, w.err }
@@ -0,0 +1,79 @@
+package sdnotify
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A Notification is a single KEY=value assignment sent to systemd. Using
+// NotifyTyped with Notifications in place of Notify with strings makes it
+// harder to pass arbitrary strings by accident.
+//
+// The package constants such as Ready and Stopping are untyped, so they may be
+// used directly as Notifications. Use Raw to convert the result of a
+// constructor such as Statusf.
+type Notification string
+
+// Raw converts s to a Notification. No validation is performed until the
+// Notification is sent.
+func Raw(s string) Notification { return Notification(s) }
+
+// NotifyTyped is like Notify, but accepts Notifications in place of strings.
+func (n *Notifier) NotifyTyped(ns ...Notification) error {
+	ss := make([]string, 0, len(ns))
+	for _, s := range ns {
+		ss = append(ss, string(s))
+	}
+
+	return n.Notify(ss...)
+}
+
+// A Marshaler is a type which can serialize itself into a notification, such
+// as a domain-specific status which produces a STATUS notification.
+type Marshaler interface {
+	MarshalNotify() (string, error)
+}
+
+var _ Marshaler = Notification("")
+
+// MarshalNotify implements Marshaler.
+func (n Notification) MarshalNotify() (string, error) { return string(n), nil }
+
+// NotifyMarshal is like Notify, but sends the notifications produced by each
+// Marshaler. The notifications are validated as with Notify. If any Marshaler
+// returns an error, NotifyMarshal returns that error without sending anything.
+func (n *Notifier) NotifyMarshal(ms ...Marshaler) error {
+	if n.disabled() {
+		return nil
+	}
+
+	ss := make([]string, 0, len(ms))
+	for _, m := range ms {
+		s, err := m.MarshalNotify()
+		if err != nil {
+			return fmt.Errorf("sdnotify: failed to marshal %T: %w", m, err)
+		}
+
+		ss = append(ss, s)
+	}
+
+	return n.Notify(ss...)
+}
+
+// NotifyMap is like Notify, but sends a KEY=value notification for each entry
+// in m, sorted by key so that the output is deterministic. The notifications
+// are validated as with Notify.
+func (n *Notifier) NotifyMap(m map[string]string) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	ss := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ss = append(ss, k+"="+m[k])
+	}
+
+	return n.Notify(ss...)
+}
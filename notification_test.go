@@ -0,0 +1,87 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierNotifyTyped(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	if err := n.NotifyTyped(sdnotify.Raw(sdnotify.Statusf("started")), sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	want := []string{"STATUS=started", sdnotify.Ready}
+	if diff := cmp.Diff(want, strings.Split(readString(t, pc), "\n")); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	// Typed notifications are validated just like strings.
+	if err := n.NotifyTyped(sdnotify.Raw("foo")); err == nil {
+		t.Fatal("expected invalid notification error")
+	}
+}
+
+// A progress is a Marshaler which reports progress through a STATUS
+// notification.
+type progress struct{ done, total int }
+
+func (p progress) MarshalNotify() (string, error) {
+	if p.total == 0 {
+		return "", errors.New("no work")
+	}
+
+	return sdnotify.Statusf("%d/%d done", p.done, p.total), nil
+}
+
+func TestNotifierNotifyMarshal(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	if err := n.NotifyMarshal(progress{done: 1, total: 2}, sdnotify.Notification(sdnotify.Watchdog)); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	want := []string{"STATUS=1/2 done", sdnotify.Watchdog}
+	if diff := cmp.Diff(want, strings.Split(readString(t, pc), "\n")); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	if err := n.NotifyMarshal(sdnotify.Notification(sdnotify.Ready), progress{}); err == nil {
+		t.Fatal("expected marshal error")
+	}
+}
+
+func TestNotifierNotifyMap(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	err := n.NotifyMap(map[string]string{
+		"STATUS": "started",
+		"READY":  "1",
+		"ERRNO":  "0",
+	})
+	if err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	want := []string{"ERRNO=0", sdnotify.Ready, "STATUS=started"}
+	if diff := cmp.Diff(want, strings.Split(readString(t, pc), "\n")); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	for _, m := range []map[string]string{
+		{"ready": "1"},
+		{"STATUS": "a\nb"},
+		{"STATUS": "a\x00b"},
+	} {
+		if err := n.NotifyMap(m); err == nil {
+			t.Fatalf("expected invalid notification error for %q", m)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package notifytest provides utilities for testing programs which send
+// systemd notifications using package sdnotify.
+package notifytest
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mdlayher/sdnotify"
+)
+
+// Listen creates a temporary unixgram listener and returns a Notifier which
+// sends notifications to it. Each received notification is split on newlines
+// and the individual messages are delivered on the returned channel in the
+// order they were sent.
+//
+// The Notifier and listener are closed automatically when the test completes,
+// after which the channel is closed.
+func Listen(t testing.TB) (*sdnotify.Notifier, <-chan string) {
+	t.Helper()
+
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("notifytest: failed to listen: %v", err)
+	}
+
+	n, err := sdnotify.Open(pc.LocalAddr().String())
+	if err != nil {
+		_ = pc.Close()
+		t.Fatalf("notifytest: failed to open notifier: %v", err)
+	}
+
+	var (
+		wg    sync.WaitGroup
+		msgC  = make(chan string, 16)
+		doneC = make(chan struct{})
+	)
+
+	wg.Add(1)
+	go func() {
+		defer func() {
+			close(msgC)
+			wg.Done()
+		}()
+
+		b := make([]byte, 4096)
+		for {
+			nb, _, err := pc.ReadFrom(b)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					t.Errorf("notifytest: failed to read: %v", err)
+				}
+				return
+			}
+
+			for _, s := range strings.Split(string(b[:nb]), "\n") {
+				select {
+				case msgC <- s:
+				case <-doneC:
+					return
+				}
+			}
+		}
+	}()
+
+	t.Cleanup(func() {
+		close(doneC)
+		_ = n.Close()
+		_ = pc.Close()
+		wg.Wait()
+	})
+
+	return n, msgC
+}
@@ -0,0 +1,33 @@
+//go:build linux
+
+package notifytest_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+	"github.com/mdlayher/sdnotify/notifytest"
+)
+
+func TestListen(t *testing.T) {
+	n, msgC := notifytest.Listen(t)
+
+	if err := n.Notify(sdnotify.Statusf("starting")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := n.Ready("done"); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	want := []string{"STATUS=starting", "STATUS=done", sdnotify.Ready}
+
+	var got []string
+	for range want {
+		got = append(got, <-msgC)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected notifications (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,308 @@
+package sdnotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// An Option configures a Notifier created by New, Open, or a related
+// constructor.
+type Option func(n *Notifier)
+
+// apply applies opts to n and returns n.
+func (n *Notifier) apply(opts []Option) *Notifier {
+	for _, o := range opts {
+		o(n)
+	}
+
+	return n
+}
+
+// WithWriteTimeout configures a Notifier to bound each write to its socket by
+// d, so that a full socket buffer cannot block the caller indefinitely. A write
+// which does not complete within d returns an error which can be checked with
+// 'errors.Is(err, context.DeadlineExceeded)'. If d is not positive, writes
+// have no timeout.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(n *Notifier) { n.timeout = d }
+}
+
+// WithSendBufferSize configures a Notifier to set the send buffer size of its
+// socket (SO_SNDBUF) to size bytes, which may avoid ENOBUFS errors for services
+// which send large STATUS notifications or many file descriptors. The kernel
+// may adjust the size, for example by doubling it or capping it at the
+// system's maximum.
+//
+// Open, OpenType, OpenFD, OpenPID, and the constructors which call them return
+// an error if size is not positive or the buffer size cannot be set.
+// WithSendBufferSize has no effect on OpenConn or OpenWriter, which cannot
+// report an error.
+func WithSendBufferSize(size int) Option {
+	return func(n *Notifier) {
+		n.sendBuffer = size
+		n.sendBufferSet = true
+	}
+}
+
+// applySendBuffer applies any WithSendBufferSize option to n's socket. If the
+// buffer size cannot be set, n is closed.
+func (n *Notifier) applySendBuffer() (*Notifier, error) {
+	if err := n.setSendBuffer(n.wc); err != nil {
+		_ = n.wc.Close()
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// setSendBuffer applies any WithSendBufferSize option to the connection wc.
+func (n *Notifier) setSendBuffer(wc io.WriteCloser) error {
+	if !n.sendBufferSet {
+		return nil
+	}
+	if n.sendBuffer <= 0 {
+		return fmt.Errorf("sdnotify: invalid send buffer size %d", n.sendBuffer)
+	}
+
+	wb, ok := wc.(interface{ SetWriteBuffer(bytes int) error })
+	if !ok {
+		return errors.New("sdnotify: notifier has no socket send buffer to configure")
+	}
+	if err := wb.SetWriteBuffer(n.sendBuffer); err != nil {
+		return fmt.Errorf("sdnotify: failed to set send buffer size: %w", err)
+	}
+
+	return nil
+}
+
+// WithUnlinkOnClose configures a Notifier to remove its socket file from the
+// filesystem when the Notifier is closed. This is useful when the Notifier's
+// socket was created solely for the service, such as by a test harness. It has
+// no effect for abstract namespace sockets or Notifiers which do not use a
+// socket path.
+func WithUnlinkOnClose(unlink bool) Option {
+	return func(n *Notifier) { n.unlink = unlink }
+}
+
+// WithStopOnClose configures a Notifier to send a Stopping notification when
+// the Notifier is closed, so that systemd does not consider a service which
+// exits without notifying it to have been killed. The Notifier is closed even
+// if the Stopping notification cannot be sent.
+func WithStopOnClose(stop bool) Option {
+	return func(n *Notifier) { n.stopOnClose = stop }
+}
+
+// WithSeparateDatagrams configures a Notifier to send each notification passed
+// to a single call as its own datagram, rather than joining them with newlines
+// into one datagram. systemd accepts either, but some minimal implementations
+// of the protocol only parse one notification per datagram. A MONOTONIC_USEC
+// notification is still sent in the same datagram as the notification which
+// follows it, since systemd requires it alongside Reloading.
+//
+// The notifications of a call are no longer sent atomically: each datagram is
+// sent in order even if an earlier one fails, and the errors from every failed
+// datagram are joined. WithSeparateDatagrams has no effect on stream sockets.
+func WithSeparateDatagrams(separate bool) Option {
+	return func(n *Notifier) { n.separate = separate }
+}
+
+// WithFlushOnClose configures a Notifier to send any notifications buffered by
+// WithBuffering when the Notifier is closed, and then to wait with Barrier until
+// systemd has processed every notification sent by the Notifier. This ensures
+// that a service which exits immediately after Close does not lose its final
+// state.
+//
+// The barrier is bounded by the timeout set by WithWriteTimeout, or by 5
+// seconds if no timeout is set. Notifiers which cannot pass file descriptors,
+// such as those created by OpenWriter, only flush their notifications. The
+// Notifier is closed even if the notifications cannot be sent.
+func WithFlushOnClose(flush bool) Option {
+	return func(n *Notifier) { n.flushOnClose = flush }
+}
+
+// WithDryRun configures a Notifier to record each notification in memory
+// instead of sending it, for use in tests which assert on the notifications a
+// service emits. Recorded notifications are grouped exactly as they would be
+// sent and can be retrieved with Sent.
+//
+// A dry run Notifier created by New, NewFromEnv, Open, or OpenType does not
+// need a notification socket and never connects to one.
+func WithDryRun(dryRun bool) Option {
+	return func(n *Notifier) { n.dryRun = dryRun }
+}
+
+// isDryRun reports whether opts enable WithDryRun.
+func isDryRun(opts []Option) bool { return (&Notifier{}).apply(opts).dryRun }
+
+// openDryRun creates a Notifier with opts which records rather than sends
+// notifications.
+func openDryRun(opts []Option) *Notifier {
+	return (&Notifier{wc: nopCloser{io.Discard}}).apply(opts)
+}
+
+// Sent returns the notifications recorded by a Notifier configured using
+// WithDryRun, in the order they were sent. Each element holds the
+// newline-delimited notifications sent in a single datagram. If n is nil or
+// Disabled, or dry run is not enabled, Sent returns nil.
+func (n *Notifier) Sent() []string {
+	if n.disabled() {
+		return nil
+	}
+	if n.parent != nil {
+		return n.parent.Sent()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]string(nil), n.sent...)
+}
+
+// WithStartupExtension configures the ExtendTimeout duration sent periodically
+// by StartupContext. If d is not positive, the default of 30 seconds is used.
+func WithStartupExtension(d time.Duration) Option {
+	return func(n *Notifier) { n.startupExtension = d }
+}
+
+// WithStatusPrefix configures a Notifier to prepend prefix to the value of
+// each STATUS notification it sends, such as "myservice: ". The prefix is
+// applied when a notification is sent, so values from Statusf and other
+// constructors are unaffected. Prefixes from Notifiers created by Scoped are
+// applied before this prefix.
+func WithStatusPrefix(prefix string) Option {
+	return func(n *Notifier) { n.prefix = prefix }
+}
+
+// WithWatchdogJitter configures StartWatchdog and WatchdogLoop to randomize
+// each interval between Watchdog notifications by up to fraction of the
+// interval in either direction, so that identical services started together
+// do not send their notifications in lockstep. fraction is limited to 0.5, so
+// that every notification is sent within three quarters of the watchdog
+// timeout. If fraction is not positive, no jitter is applied.
+func WithWatchdogJitter(fraction float64) Option {
+	return func(n *Notifier) { n.jitter = fraction }
+}
+
+// WithLogger configures a Notifier to log each notification it sends, along
+// with any resulting error, to l at debug level. By default, nothing is
+// logged.
+func WithLogger(l *slog.Logger) Option {
+	return func(n *Notifier) { n.logger = l }
+}
+
+// logSent logs the sent payload b and any error if a logger is configured.
+func (n *Notifier) logSent(ctx context.Context, b []byte, err error) {
+	if n.logger == nil {
+		return
+	}
+
+	if err != nil {
+		n.logger.DebugContext(ctx, "failed to send systemd notification",
+			slog.String("payload", string(b)), slog.Any("error", err))
+		return
+	}
+
+	n.logger.DebugContext(ctx, "sent systemd notification", slog.String("payload", string(b)))
+}
+
+// Metrics receives observations about the notifications sent by a Notifier,
+// such as for exporting Prometheus counters.
+type Metrics interface {
+	// Inc is called once for each notification sent successfully, with the
+	// notification's key such as "READY", "STATUS", or "WATCHDOG".
+	Inc(state string)
+
+	// ObserveErr is called with the error from each failed send.
+	ObserveErr(err error)
+}
+
+// WithMetrics configures a Notifier to report each notification it sends to
+// m. By default, no metrics are reported.
+func WithMetrics(m Metrics) Option {
+	return func(n *Notifier) { n.metrics = m }
+}
+
+// observe reports the sent payload b or err to the configured Metrics.
+func (n *Notifier) observe(b []byte, err error) {
+	if n.metrics == nil {
+		return
+	}
+
+	if err != nil {
+		n.metrics.ObserveErr(err)
+		return
+	}
+
+	for _, s := range strings.Split(string(b), "\n") {
+		if k, _, ok := strings.Cut(s, "="); ok {
+			n.metrics.Inc(k)
+		}
+	}
+}
+
+// WithUnsetEnv configures New to unset the NOTIFY_SOCKET environment variable
+// once its value has been read, as recommended by sd_notify(3) for long-running
+// daemons. This prevents child processes from inheriting the socket and
+// sending notifications on behalf of the service, which they may not be
+// permitted or expected to do. Subsequent calls to New will behave as if no
+// socket is set.
+//
+// WithUnsetEnv has no effect on Open or NewFromEnv.
+func WithUnsetEnv(unset bool) Option {
+	return func(n *Notifier) { n.unsetEnv = unset }
+}
+
+// WithRetry configures a Notifier to retry sending notifications which fail
+// with a transient error such as ENOBUFS or EAGAIN, as may occur when the
+// socket buffer is full on a busy system. A notification is attempted up to
+// attempts times, waiting for backoff before the first retry and doubling the
+// wait before each later retry.
+//
+// If attempts is less than 2, notifications are never retried.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(n *Notifier) {
+		n.retries = attempts
+		n.backoff = backoff
+	}
+}
+
+// sendRetry sends b and oob using send, retrying transient errors as
+// configured by WithRetry. The caller must hold n.mu.
+func (n *Notifier) sendRetry(ctx context.Context, b, oob []byte) error {
+	err := n.send(b, oob)
+	if n.retries < 2 {
+		return socketErr(err)
+	}
+
+	d := n.backoff
+	for i := 1; i < n.retries && retryable(err); i++ {
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		err = n.send(b, oob)
+		d *= 2
+	}
+
+	if retryable(err) {
+		return fmt.Errorf("sdnotify: failed to send notification after %d attempts: %w", n.retries, err)
+	}
+
+	return socketErr(err)
+}
+
+// retryable reports whether err is a transient error which may succeed if the
+// send is retried.
+func retryable(err error) bool {
+	return errors.Is(err, syscall.ENOBUFS) || errors.Is(err, syscall.EAGAIN)
+}
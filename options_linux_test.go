@@ -0,0 +1,428 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+	"golang.org/x/sys/unix"
+)
+
+func TestWithWriteTimeout(t *testing.T) {
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	n, err := sdnotify.Open(pc.LocalAddr().String(), sdnotify.WithWriteTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer n.Close()
+
+	// The listener never reads, so eventually writes block until the timeout.
+	for {
+		err := n.Notify(sdnotify.Statusf("%s", strings.Repeat("a", 1024)))
+		if err == nil {
+			continue
+		}
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, but got: %v", err)
+		}
+
+		break
+	}
+
+	// Drain the listener so the socket buffer has room again.
+	b := make([]byte, 4096)
+	for {
+		if err := pc.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+			t.Fatalf("failed to set deadline: %v", err)
+		}
+		if _, _, err := pc.ReadFrom(b); err != nil {
+			break
+		}
+	}
+
+	// The deadline from the failed write must not affect later writes.
+	if err := n.Notify(sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify after timeout: %v", err)
+	}
+}
+
+func TestWithUnlinkOnClose(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(sock string) string
+	}{
+		{
+			name: "path",
+			fn:   func(sock string) string { return sock },
+		},
+		{
+			// The whitespace ignored by ParseSocket must not prevent removal.
+			name: "whitespace",
+			fn:   func(sock string) string { return " " + sock + "\n" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sock := filepath.Join(t.TempDir(), "notify.sock")
+
+			pc, err := net.ListenPacket("unixgram", sock)
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer pc.Close()
+
+			n, err := sdnotify.Open(tt.fn(sock), sdnotify.WithUnlinkOnClose(true))
+			if err != nil {
+				t.Fatalf("failed to open: %v", err)
+			}
+
+			if err := n.Close(); err != nil {
+				t.Fatalf("failed to close: %v", err)
+			}
+
+			if _, err := os.Stat(sock); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected socket to be removed, but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestWithStopOnClose(t *testing.T) {
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	n, err := sdnotify.Open(pc.LocalAddr().String(), sdnotify.WithStopOnClose(true))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	if err := n.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	// The notification must have been sent before the socket was closed.
+	if diff := cmp.Diff(sdnotify.Stopping, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	// The nil Notifier returned when no socket is configured ignores the
+	// option.
+	t.Setenv(sdnotify.Socket, "")
+	dn, err := sdnotify.New(sdnotify.WithStopOnClose(true))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist, but got: %v", err)
+	}
+	if err := dn.Close(); err != nil {
+		t.Fatalf("failed to close disabled: %v", err)
+	}
+}
+
+func TestWithFlushOnClose(t *testing.T) {
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	n, err := sdnotify.Open(
+		pc.LocalAddr().String(),
+		sdnotify.WithBuffering(true),
+		sdnotify.WithFlushOnClose(true),
+	)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	if err := n.Notify(sdnotify.Statusf("finished")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	errC := make(chan error, 1)
+	go func() { errC <- n.Close() }()
+
+	// The buffered status must be sent before the barrier, and Close must not
+	// return until the barrier completes.
+	if diff := cmp.Diff("STATUS=finished", readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	s, fds := readRights(t, pc)
+	if diff := cmp.Diff("BARRIER=1", s); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	select {
+	case err := <-errC:
+		t.Fatalf("close returned before barrier: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for _, fd := range fds {
+		_ = unix.Close(fd)
+	}
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+}
+
+func TestWithDryRun(t *testing.T) {
+	// No socket is required for a dry run.
+	t.Setenv(sdnotify.Socket, "")
+
+	n, err := sdnotify.New(sdnotify.WithDryRun(true))
+	if err != nil {
+		t.Fatalf("failed to create notifier: %v", err)
+	}
+	defer n.Close()
+
+	if err := n.Notify(sdnotify.Statusf("starting")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := n.Ready("started"); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := n.StoreNamed("http", os.Stdin); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+	if err := n.Stop(""); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	want := []string{
+		"STATUS=starting",
+		"STATUS=started\nREADY=1",
+		"FDSTORE=1\nFDNAME=http",
+		"STOPPING=1",
+	}
+
+	if diff := cmp.Diff(want, n.Sent()); diff != "" {
+		t.Fatalf("unexpected notifications (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithUnsetEnv(t *testing.T) {
+	_, pc := testNotifier(t)
+	t.Setenv(sdnotify.Socket, pc.LocalAddr().String())
+
+	n, err := sdnotify.New(sdnotify.WithUnsetEnv(true))
+	if err != nil {
+		t.Fatalf("failed to create notifier: %v", err)
+	}
+	defer n.Close()
+
+	if s, ok := os.LookupEnv(sdnotify.Socket); ok {
+		t.Fatalf("expected NOTIFY_SOCKET to be unset, but got %q", s)
+	}
+
+	// The Notifier still works, but new ones cannot be created.
+	if err := n.Notify(sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if diff := cmp.Diff(sdnotify.Ready, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	if _, err := sdnotify.New(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		ok       bool
+	}{
+		{
+			name:     "succeeds",
+			failures: 2,
+			ok:       true,
+		},
+		{
+			name:     "gives up",
+			failures: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &flakyWriter{failures: tt.failures}
+			n := sdnotify.OpenWriter(w, sdnotify.WithRetry(3, time.Millisecond))
+
+			err := n.Notify(sdnotify.Ready)
+			if !tt.ok {
+				if !errors.Is(err, unix.ENOBUFS) {
+					t.Fatalf("expected ENOBUFS, but got: %v", err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to notify: %v", err)
+			}
+
+			if diff := cmp.Diff("READY=1\n", w.buf.String()); diff != "" {
+				t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWithRetryNotRetryable(t *testing.T) {
+	w := &flakyWriter{failures: 1, err: unix.EPERM}
+	n := sdnotify.OpenWriter(w, sdnotify.WithRetry(3, time.Millisecond))
+
+	if err := n.Notify(sdnotify.Ready); !errors.Is(err, unix.EPERM) {
+		t.Fatalf("expected EPERM, but got: %v", err)
+	}
+	if w.calls != 1 {
+		t.Fatalf("expected 1 write, but got %d", w.calls)
+	}
+}
+
+// A flakyWriter fails its first writes with an error, ENOBUFS by default.
+type flakyWriter struct {
+	failures, calls int
+	err             error
+	buf             bytes.Buffer
+}
+
+func (w *flakyWriter) Write(b []byte) (int, error) {
+	w.calls++
+	if w.calls <= w.failures {
+		if w.err != nil {
+			return 0, w.err
+		}
+
+		return 0, unix.ENOBUFS
+	}
+
+	return w.buf.Write(b)
+}
+
+func TestWithSendBufferSize(t *testing.T) {
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	const size = 8192
+
+	n, err := sdnotify.Open(pc.LocalAddr().String(), sdnotify.WithSendBufferSize(size))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer n.Close()
+
+	checkSendBuffer := func() {
+		t.Helper()
+
+		fd, err := n.DupFD()
+		if err != nil {
+			t.Fatalf("failed to duplicate socket: %v", err)
+		}
+		defer unix.Close(fd)
+
+		// Linux doubles the requested size to account for bookkeeping
+		// overhead.
+		got, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF)
+		if err != nil {
+			t.Fatalf("failed to get send buffer size: %v", err)
+		}
+		if got != 2*size {
+			t.Fatalf("unexpected send buffer size: %d", got)
+		}
+	}
+
+	checkSendBuffer()
+
+	// The new connection created by Reset must use the same size.
+	if err := n.Reset(); err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	checkSendBuffer()
+
+	for _, size := range []int{0, -1} {
+		if _, err := sdnotify.Open(pc.LocalAddr().String(), sdnotify.WithSendBufferSize(size)); err == nil {
+			t.Fatalf("expected an error for send buffer size %d", size)
+		}
+	}
+}
+
+func TestWithSeparateDatagrams(t *testing.T) {
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	n, err := sdnotify.Open(pc.LocalAddr().String(), sdnotify.WithSeparateDatagrams(true))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer n.Close()
+
+	if err := n.Notify(sdnotify.Statusf("started"), sdnotify.MainPID(1), sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	// MONOTONIC_USEC must remain with RELOADING.
+	mono := sdnotify.MonotonicUsec(time.Now())
+	if err := n.Notify(mono, sdnotify.Reloading); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	want := []string{"STATUS=started", "MAINPID=1", sdnotify.Ready, mono + "\n" + sdnotify.Reloading}
+
+	var got []string
+	for range want {
+		got = append(got, readString(t, pc))
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected datagrams (-want +got):\n%s", diff)
+	}
+
+	// Every datagram is attempted and each failure is reported.
+	_ = pc.Close()
+	err = n.Notify(sdnotify.Statusf("stopping"), sdnotify.Stopping)
+	if !sdnotify.IsSocketUnavailable(err) {
+		t.Fatalf("expected socket unavailable, but got: %v", err)
+	}
+	if jerr, ok := err.(interface{ Unwrap() []error }); !ok || len(jerr.Unwrap()) != 2 {
+		t.Fatalf("expected 2 joined errors, but got: %v", err)
+	}
+}
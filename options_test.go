@@ -0,0 +1,114 @@
+package sdnotify_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestWithStatusPrefix(t *testing.T) {
+	w := &strings.Builder{}
+	n := sdnotify.OpenWriter(w, sdnotify.WithStatusPrefix("myservice: "))
+
+	if err := n.Scoped("db: ").Ready("connected"); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := n.Notify(sdnotify.Watchdog); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	want := "STATUS=myservice: db: connected\nREADY=1\nWATCHDOG=1\n"
+	if diff := cmp.Diff(want, w.String()); diff != "" {
+		t.Fatalf("unexpected notifications (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var logs bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		// Drop timestamps for stable output.
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+
+			return a
+		},
+	}))
+
+	n := sdnotify.OpenWriter(io.Discard, sdnotify.WithLogger(l))
+	if err := n.Notify(sdnotify.Statusf("started"), sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	errA := errors.New("A")
+	n = sdnotify.OpenWriter(errWriter{errA}, sdnotify.WithLogger(l))
+	if err := n.Notify(sdnotify.Stopping); !errors.Is(err, errA) {
+		t.Fatalf("expected write error, but got: %v", err)
+	}
+
+	const want = `level=DEBUG msg="sent systemd notification" payload="STATUS=started\nREADY=1"
+level=DEBUG msg="failed to send systemd notification" payload="STOPPING=1" error=A
+`
+
+	if diff := cmp.Diff(want, logs.String()); diff != "" {
+		t.Fatalf("unexpected logs (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	var m testMetrics
+	n := sdnotify.OpenWriter(io.Discard, sdnotify.WithMetrics(&m))
+
+	for i := 0; i < 3; i++ {
+		if err := n.Notify(sdnotify.Watchdog); err != nil {
+			t.Fatalf("failed to notify: %v", err)
+		}
+	}
+	if err := n.Ready("started"); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	errA := errors.New("A")
+	n = sdnotify.OpenWriter(errWriter{errA}, sdnotify.WithMetrics(&m))
+	if err := n.Notify(sdnotify.Stopping); !errors.Is(err, errA) {
+		t.Fatalf("expected write error, but got: %v", err)
+	}
+
+	want := testMetrics{
+		counts: map[string]int{
+			"READY":    1,
+			"STATUS":   1,
+			"WATCHDOG": 3,
+		},
+		errs: []error{errA},
+	}
+
+	if diff := cmp.Diff(want, m, cmp.AllowUnexported(testMetrics{}), cmpopts.EquateErrors()); diff != "" {
+		t.Fatalf("unexpected metrics (-want +got):\n%s", diff)
+	}
+}
+
+// testMetrics is a sdnotify.Metrics which records its observations.
+type testMetrics struct {
+	counts map[string]int
+	errs   []error
+}
+
+func (m *testMetrics) Inc(state string) {
+	if m.counts == nil {
+		m.counts = make(map[string]int)
+	}
+
+	m.counts[state]++
+}
+
+func (m *testMetrics) ObserveErr(err error) { m.errs = append(m.errs, err) }
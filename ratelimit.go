@@ -0,0 +1,91 @@
+package sdnotify
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// WithStatusRateLimit configures a Notifier to send at most one STATUS-only
+// notification per interval, so that a service which updates its status very
+// frequently does not flood the journal. Calls to Notify which only contain
+// STATUS notifications within interval of the last status sent are coalesced,
+// and the most recent status is sent when the interval elapses or when the
+// Notifier is closed.
+//
+// Calls which include any other notification, such as READY, STOPPING, or
+// WATCHDOG, are never delayed, and any pending status is sent along with them.
+// If interval is not positive, STATUS notifications are not rate limited.
+func WithStatusRateLimit(interval time.Duration) Option {
+	return func(n *Notifier) { n.statusInterval = interval }
+}
+
+// rateLimit applies the STATUS rate limit to the validated notifications in s,
+// returning the notifications which must be sent immediately.
+func (n *Notifier) rateLimit(s []string) []string {
+	n.rlMu.Lock()
+	defer n.rlMu.Unlock()
+
+	var status, other bool
+	for _, ss := range s {
+		if strings.HasPrefix(ss, "STATUS=") {
+			status = true
+		} else {
+			other = true
+		}
+	}
+
+	now := time.Now()
+	switch {
+	case other && !status && n.pending != "":
+		// Deliver the pending status in order, ahead of the state change.
+		s = append([]string{n.pending}, s...)
+		fallthrough
+	case other, now.Sub(n.lastStatus) >= n.statusInterval:
+		if status || n.pending != "" {
+			n.lastStatus = now
+		}
+
+		n.clearPending()
+		return s
+	}
+
+	// Only the latest status is meaningful.
+	for _, ss := range s {
+		n.pending = ss
+	}
+	if n.rlTimer == nil {
+		n.rlTimer = time.AfterFunc(n.lastStatus.Add(n.statusInterval).Sub(now), func() {
+			n.background(n.flushStatus())
+		})
+	}
+
+	return nil
+}
+
+// flushStatus sends any status held back by rateLimit.
+func (n *Notifier) flushStatus() error {
+	n.rlMu.Lock()
+	p := n.pending
+	if p != "" {
+		n.lastStatus = time.Now()
+	}
+	n.clearPending()
+	n.rlMu.Unlock()
+
+	if p == "" {
+		return nil
+	}
+
+	return n.deliver(context.Background(), []string{p})
+}
+
+// clearPending discards the pending status and its timer. The caller must hold
+// n.rlMu.
+func (n *Notifier) clearPending() {
+	n.pending = ""
+	if n.rlTimer != nil {
+		n.rlTimer.Stop()
+		n.rlTimer = nil
+	}
+}
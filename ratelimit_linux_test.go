@@ -0,0 +1,66 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestWithStatusRateLimit(t *testing.T) {
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	const interval = 50 * time.Millisecond
+	n, err := sdnotify.Open(pc.LocalAddr().String(), sdnotify.WithStatusRateLimit(interval))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer n.Close()
+
+	const total = 1000
+	start := time.Now()
+	for i := 0; i < total; i++ {
+		if err := n.Notify(sdnotify.Statusf("status %d", i)); err != nil {
+			t.Fatalf("failed to notify: %v", err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	// The final status must always be delivered after the interval.
+	var got int
+	for {
+		got++
+		if readString(t, pc) == fmt.Sprintf("STATUS=status %d", total-1) {
+			break
+		}
+	}
+
+	if max := int(elapsed/interval) + 2; got > max {
+		t.Fatalf("expected at most %d statuses, but got %d", max, got)
+	}
+
+	// State changes are never delayed, and carry any pending status.
+	if err := n.Notify(sdnotify.Statusf("held")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := n.Notify(sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	if diff := cmp.Diff("STATUS=held\nREADY=1", readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
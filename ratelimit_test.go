@@ -0,0 +1,27 @@
+package sdnotify_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestWithStatusRateLimitScoped(t *testing.T) {
+	var buf bytes.Buffer
+	n := sdnotify.OpenWriter(&buf, sdnotify.WithStatusRateLimit(time.Hour))
+	s := n.Scoped("s: ")
+
+	for i := 0; i < 5; i++ {
+		if err := s.Notify(sdnotify.Statusf("%d", i)); err != nil {
+			t.Fatalf("failed to notify: %v", err)
+		}
+	}
+
+	// Only the first status is sent until the interval elapses.
+	if diff := cmp.Diff("STATUS=s: 0\n", buf.String()); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
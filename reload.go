@@ -0,0 +1,73 @@
+package sdnotify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Reload performs a reload of the service's configuration by calling fn,
+// bracketed by the notifications systemd expects for a reload cycle.
+//
+// Reload first sends Reloading and MonotonicUsec notifications. If fn returns
+// nil, Reload then sends a Ready notification. If fn returns an error, Reload
+// sends a STATUS notification describing the error along with a Ready
+// notification so that systemd does not wait indefinitely for the reload to
+// complete, and returns the error from fn.
+//
+// ctx bounds each notification sent by Reload, but is not passed to fn. If n
+// is nil or Disabled, Reload only calls fn.
+func (n *Notifier) Reload(ctx context.Context, fn func() error) error {
+	if err := n.NotifyContext(ctx, Monotonic(), Reloading); err != nil {
+		return err
+	}
+
+	if ferr := fn(); ferr != nil {
+		if err := n.NotifyContext(ctx, Statusf("reload failed: %v", ferr), Ready); err != nil {
+			return fmt.Errorf("sdnotify: failed to notify after reload error %v: %w", ferr, err)
+		}
+
+		return ferr
+	}
+
+	return n.NotifyContext(ctx, Ready)
+}
+
+// OnReload calls Reload with fn each time the process receives one of the
+// input signals, or SIGHUP if no signals are specified. This implements the
+// reload protocol for the common case of a daemon which reloads its
+// configuration on SIGHUP, such as one configured with
+// 'ExecReload=kill -HUP $MAINPID'.
+//
+// OnReload blocks until ctx is canceled, at which point it stops handling the
+// signals and returns ctx.Err(). An error returned by fn is reported to systemd
+// as described by Reload and does not stop OnReload, but OnReload returns
+// immediately if a notification cannot be sent.
+func (n *Notifier) OnReload(ctx context.Context, fn func() error, sigs ...os.Signal) error {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, sigs...)
+	defer signal.Stop(sigC)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sigC:
+		}
+
+		var ferr error
+		err := n.Reload(ctx, func() error {
+			ferr = fn()
+			return ferr
+		})
+		if err != nil && err != ferr {
+			return err
+		}
+	}
+}
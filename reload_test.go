@@ -0,0 +1,124 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierReload(t *testing.T) {
+	errReload := errors.New("bad config\nline 2")
+
+	tests := []struct {
+		name string
+		err  error
+		ss   []string
+	}{
+		{
+			name: "OK",
+			ss:   []string{sdnotify.Ready},
+		},
+		{
+			name: "error",
+			err:  errReload,
+			ss: []string{
+				"STATUS=reload failed: bad config line 2",
+				sdnotify.Ready,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, pc := testNotifier(t)
+
+			var called bool
+			err := n.Reload(context.Background(), func() error {
+				called = true
+
+				// The reload notification must arrive before fn is called.
+				ss := strings.Split(readString(t, pc), "\n")
+				if len(ss) != 2 || !strings.HasPrefix(ss[0], "MONOTONIC_USEC=") || ss[1] != sdnotify.Reloading {
+					t.Fatalf("unexpected reload notification: %q", ss)
+				}
+
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected reload error: %v", err)
+			}
+			if !called {
+				t.Fatal("reload function was not called")
+			}
+
+			if diff := cmp.Diff(tt.ss, strings.Split(readString(t, pc), "\n")); diff != "" {
+				t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNotifierOnReload(t *testing.T) {
+	// Keep SIGHUP from terminating the test binary before OnReload has
+	// registered its own handler.
+	guardC := make(chan os.Signal, 1)
+	signal.Notify(guardC, syscall.SIGHUP)
+	defer signal.Stop(guardC)
+
+	n, pc := testNotifier(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calledC := make(chan struct{}, 1)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- n.OnReload(ctx, func() error {
+			select {
+			case calledC <- struct{}{}:
+			default:
+			}
+
+			return nil
+		})
+	}()
+
+	// The handler may not be registered yet, so signal until fn is called.
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+
+	for done := false; !done; {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatalf("failed to signal: %v", err)
+		}
+
+		select {
+		case <-calledC:
+			done = true
+		case <-tick.C:
+		}
+	}
+
+	ss := strings.Split(readString(t, pc), "\n")
+	if len(ss) != 2 || !strings.HasPrefix(ss[0], "MONOTONIC_USEC=") || ss[1] != sdnotify.Reloading {
+		t.Fatalf("unexpected reload notification: %q", ss)
+	}
+	if diff := cmp.Diff(sdnotify.Ready, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	cancel()
+	if err := <-errC; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, but got: %v", err)
+	}
+}
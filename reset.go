@@ -0,0 +1,147 @@
+package sdnotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Reset reconnects the Notifier to the notification socket, such as after a
+// systemd daemon-reexec recreates it and later notifications fail with an error
+// which wraps ErrSocketGone. Reset re-reads NOTIFY_SOCKET from the Notifier's
+// environment and falls back to the socket the Notifier was opened with if it
+// is unset. If n is nil or Disabled, Reset is a no-op.
+//
+// Reset dials the new connection and configures it as the Notifier's options
+// require, such as WithSendBufferSize, before replacing the old one, so if
+// Reset fails, n continues to use its existing connection. Reset is safe to
+// call concurrently with other methods: notifications already being written
+// when Reset replaces the connection complete or fail on the old connection,
+// and later notifications are sent on the new one. A net.Conn returned by
+// LocalAddr or RemoteAddr before Reset refers to the old connection.
+//
+// Reset returns an error for Notifiers which were not opened from a socket
+// path, such as those created by OpenConn, OpenFD, or OpenWriter.
+func (n *Notifier) Reset() error {
+	if n.disabled() {
+		return nil
+	}
+	if n.parent != nil {
+		// The parent owns the connection.
+		return n.parent.Reset()
+	}
+	if n.multi != nil {
+		return n.forEach((*Notifier).Reset)
+	}
+	if n.dryRun {
+		return nil
+	}
+
+	n.mu.Lock()
+	sock, stream, creds := n.sock, n.stream, n.creds
+	n.mu.Unlock()
+
+	if sock == "" {
+		return errors.New("sdnotify: cannot reset a Notifier which was not opened from a socket path")
+	}
+	if s := n.getenv(Socket); s != "" {
+		sock = s
+	}
+
+	network := "unixgram"
+	if stream {
+		network = "unix"
+	}
+
+	c, addr, err := dial(context.Background(), network, sock)
+	if err != nil {
+		return fmt.Errorf("sdnotify: failed to reset notifier: %w", err)
+	}
+	if creds != nil {
+		if err := setPassCred(c); err != nil {
+			_ = c.Close()
+			return err
+		}
+	}
+	if err := n.setSendBuffer(c); err != nil {
+		_ = c.Close()
+		return err
+	}
+
+	// Wait for in-flight writes to finish before swapping in the new
+	// connection.
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.connMu.Lock()
+	old := n.wc
+	n.wc = c
+	n.connMu.Unlock()
+
+	n.sock = addr
+
+	if err := old.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// probe is sent by WaitSocketReady. systemd ignores variables it does not
+// recognize, and sd_notify(3) recommends the X_ prefix for those defined by
+// applications.
+const probe = "X_SDNOTIFY_PROBE=1"
+
+// WaitSocketReady blocks until the notification socket accepts notifications,
+// or until ctx is canceled. It is useful in container environments where the
+// socket file may exist before systemd is receiving on it, in which case early
+// notifications such as Ready would be lost.
+//
+// WaitSocketReady sends a notification which systemd ignores. While the
+// socket refuses it, WaitSocketReady reconnects as with Reset and tries again
+// with an increasing delay. If ctx is canceled or its deadline is exceeded
+// first, WaitSocketReady returns ctx.Err(). If n is nil or Disabled,
+// WaitSocketReady is a no-op.
+func (n *Notifier) WaitSocketReady(ctx context.Context) error {
+	if n.disabled() || n.dryRun {
+		return nil
+	}
+	if n.parent != nil {
+		return n.parent.WaitSocketReady(ctx)
+	}
+	if n.multi != nil {
+		return n.forEach(func(mn *Notifier) error { return mn.WaitSocketReady(ctx) })
+	}
+
+	const maxProbeDelay = time.Second
+
+	delay := 10 * time.Millisecond
+	for {
+		err := n.write(ctx, []byte(probe))
+		if err == nil || !IsSocketUnavailable(err) {
+			return err
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		if delay *= 2; delay > maxProbeDelay {
+			delay = maxProbeDelay
+		}
+
+		// The connection refers to the socket's previous receiver, if any, so
+		// connect again. The socket may still be refusing connections.
+		if err := n.Reset(); err != nil && !errors.Is(err, syscall.ECONNREFUSED) && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,180 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierReset(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "notify.sock")
+
+	listen := func() net.PacketConn {
+		pc, err := net.ListenPacket("unixgram", sock)
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		t.Cleanup(func() { _ = pc.Close() })
+
+		if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatalf("failed to set deadline: %v", err)
+		}
+
+		return pc
+	}
+
+	pc := listen()
+
+	n, err := sdnotify.NewFromEnv(func(string) string { return sock })
+	if err != nil {
+		t.Fatalf("failed to create Notifier: %v", err)
+	}
+	defer n.Close()
+
+	// Simulate systemd recreating its socket.
+	_ = pc.Close()
+	if err := os.Remove(sock); err != nil {
+		t.Fatalf("failed to remove socket: %v", err)
+	}
+
+	if err := n.Notify(sdnotify.Watchdog); !sdnotify.IsSocketUnavailable(err) {
+		t.Fatalf("expected socket unavailable, but got: %v", err)
+	}
+
+	pc = listen()
+	if err := n.Reset(); err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+
+	if err := n.Notify(sdnotify.Watchdog); err != nil {
+		t.Fatalf("failed to notify after reset: %v", err)
+	}
+	if got := readString(t, pc); got != sdnotify.Watchdog {
+		t.Fatalf("unexpected notification: %q", got)
+	}
+}
+
+func TestNotifierResetConcurrent(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	const workers = 4
+
+	var wg sync.WaitGroup
+	wg.Add(workers + 1)
+	defer wg.Wait()
+
+	// Every notification sent during a Reset must be delivered whole on either
+	// the old or new connection.
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := n.Notify(sdnotify.Watchdog); err != nil {
+					panicf("failed to notify: %v", err)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 10; j++ {
+			if err := n.Reset(); err != nil {
+				panicf("failed to reset: %v", err)
+			}
+		}
+	}()
+
+	b := make([]byte, 128)
+	for i := 0; i < workers*10; i++ {
+		nn, _, err := pc.ReadFrom(b)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if got := b[:nn]; !bytes.Equal(got, []byte(sdnotify.Watchdog)) {
+			t.Fatalf("unexpected notification: %q", got)
+		}
+	}
+}
+
+func TestNotifierWaitSocketReady(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "notify.sock")
+
+	pc, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	n, err := sdnotify.Open(sock)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer n.Close()
+
+	// Leave the socket file in place with no receiver, as when systemd has not
+	// yet bound it.
+	_ = pc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errC := make(chan error, 1)
+	go func() { errC <- n.WaitSocketReady(ctx) }()
+
+	select {
+	case err := <-errC:
+		t.Fatalf("returned before the socket was ready: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.Remove(sock); err != nil {
+		t.Fatalf("failed to remove socket: %v", err)
+	}
+	pc, err = net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to wait for socket: %v", err)
+	}
+
+	// The probe is received, and notifications now reach the new receiver.
+	if got := readString(t, pc); !strings.HasPrefix(got, "X_") {
+		t.Fatalf("unexpected probe: %q", got)
+	}
+	if err := n.Ready(""); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if got := readString(t, pc); got != sdnotify.Ready {
+		t.Fatalf("unexpected notification: %q", got)
+	}
+}
+
+func TestNotifierWaitSocketReadyTimeout(t *testing.T) {
+	n, pc := testNotifier(t)
+	_ = pc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := n.WaitSocketReady(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+package sdnotify_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierResetNoSocket(t *testing.T) {
+	n := sdnotify.OpenWriter(&bytes.Buffer{})
+	if err := n.Reset(); err == nil {
+		t.Fatal("expected an error resetting a Notifier without a socket")
+	}
+}
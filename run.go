@@ -0,0 +1,72 @@
+package sdnotify
+
+import (
+	"context"
+	"sync"
+)
+
+// Run manages the lifecycle of a service under systemd supervision. It sends a
+// STATUS notification reporting that the service is starting and then calls
+// start in a new goroutine, passing ctx and a ready function which start must
+// call once the service is ready to serve.
+//
+// The first call to ready sends a Ready notification and, if the watchdog is
+// enabled, starts sending Watchdog notifications as with StartWatchdog. ready
+// returns any error which occurs while sending the Ready notification, and
+// later calls are no-ops.
+//
+// When ctx is canceled, Run sends a Stopping notification and waits for start
+// to return, so start must also return once ctx is canceled. If start returns
+// without ctx being canceled, Run sends a STATUS notification describing any
+// error along with a Stopping notification. Run returns the error from start,
+// or if start returns nil, any error sending the Stopping notification.
+//
+// For advanced use cases, the primitives used by Run, such as Ready,
+// StartWatchdog, and Stop, may be used directly. If n is nil or Disabled, Run
+// only calls start.
+func (n *Notifier) Run(ctx context.Context, start func(ctx context.Context, ready func() error) error) error {
+	if err := n.NotifyContext(ctx, Statusf("starting")); err != nil {
+		return err
+	}
+
+	// Stop the watchdog as soon as the service begins stopping.
+	wdCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var once sync.Once
+	ready := func() error {
+		var err error
+		once.Do(func() {
+			if err = n.Ready(""); err != nil {
+				return
+			}
+
+			_, err = n.StartWatchdog(wdCtx)
+		})
+
+		return err
+	}
+
+	errC := make(chan error, 1)
+	go func() { errC <- start(ctx, ready) }()
+
+	select {
+	case <-ctx.Done():
+		cancel()
+		serr := n.Stop("")
+
+		if err := <-errC; err != nil {
+			return err
+		}
+
+		return serr
+	case err := <-errC:
+		cancel()
+		if err != nil {
+			_ = n.Notify(Statusf("failed: %v", err), Stopping)
+			return err
+		}
+
+		return n.Stop("")
+	}
+}
@@ -0,0 +1,75 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierRun(t *testing.T) {
+	t.Setenv(sdnotify.WatchdogUsec, "")
+
+	n, pc := testNotifier(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := func(ctx context.Context, ready func() error) error {
+		if err := ready(); err != nil {
+			return err
+		}
+
+		// Repeated calls are no-ops.
+		if err := ready(); err != nil {
+			return err
+		}
+
+		<-ctx.Done()
+		return nil
+	}
+
+	errC := make(chan error, 1)
+	go func() { errC <- n.Run(ctx, start) }()
+
+	for _, want := range []string{"STATUS=starting", sdnotify.Ready} {
+		if diff := cmp.Diff(want, readString(t, pc)); diff != "" {
+			t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+		}
+	}
+
+	cancel()
+	if diff := cmp.Diff(sdnotify.Stopping, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to run: %v", err)
+	}
+}
+
+func TestNotifierRunError(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	errStart := errors.New("failed to listen")
+	err := n.Run(context.Background(), func(_ context.Context, _ func() error) error {
+		return errStart
+	})
+	if !errors.Is(err, errStart) {
+		t.Fatalf("expected start error, but got: %v", err)
+	}
+
+	if diff := cmp.Diff("STATUS=starting", readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	want := []string{"STATUS=failed: failed to listen", sdnotify.Stopping}
+	if diff := cmp.Diff(want, strings.Split(readString(t, pc), "\n")); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,44 @@
+package sdnotify
+
+import "strings"
+
+// Scoped creates a Notifier for a subsystem of a larger program which sends
+// notifications using n's connection, prefixing the value of each STATUS
+// notification with prefix. For example, with prefix "db: ", the notification
+// "STATUS=connected" is sent as "STATUS=db: connected".
+//
+// The Scoped Notifier shares n's connection and configuration, including any
+// buffering and rate limiting, so its notifications are delivered in order with
+// those of n. It is safe for concurrent use with n and any other Notifiers
+// scoped from n. Closing the Scoped Notifier is a no-op; once n is closed, the
+// Scoped Notifier can no longer send notifications. If n is nil or Disabled,
+// so is the returned Notifier.
+func (n *Notifier) Scoped(prefix string) *Notifier {
+	if n.disabled() {
+		return Disabled()
+	}
+
+	return &Notifier{
+		parent: n,
+		prefix: prefix,
+	}
+}
+
+// applyPrefix returns s with n's status prefix added to each STATUS
+// notification.
+func (n *Notifier) applyPrefix(s []string) []string {
+	if n.prefix == "" {
+		return s
+	}
+
+	out := make([]string, 0, len(s))
+	for _, ss := range s {
+		if v, ok := strings.CutPrefix(ss, "STATUS="); ok {
+			ss = "STATUS=" + n.prefix + v
+		}
+
+		out = append(out, ss)
+	}
+
+	return out
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierScoped(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	db := n.Scoped("db: ")
+	replica := db.Scoped("replica: ")
+
+	if err := replica.Notify(sdnotify.Statusf("connected"), sdnotify.Watchdog); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	want := []string{"STATUS=db: replica: connected", sdnotify.Watchdog}
+	if diff := cmp.Diff(want, strings.Split(readString(t, pc), "\n")); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	// Closing a Scoped Notifier leaves the shared connection open.
+	if err := db.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if err := n.Ready(""); err != nil {
+		t.Fatalf("failed to notify after scoped close: %v", err)
+	}
+	if diff := cmp.Diff(sdnotify.Ready, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(n.RemoteAddr().String(), db.RemoteAddr().String()); diff != "" {
+		t.Fatalf("unexpected remote address (-want +got):\n%s", diff)
+	}
+}
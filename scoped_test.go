@@ -0,0 +1,40 @@
+package sdnotify_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierScopedBuffering(t *testing.T) {
+	var buf bytes.Buffer
+	n := sdnotify.OpenWriter(&buf, sdnotify.WithBuffering(true))
+	s := n.Scoped("s: ")
+
+	if err := n.Notify(sdnotify.Statusf("a")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := s.Notify(sdnotify.Statusf("b")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected buffered notifications, but got: %q", buf.String())
+	}
+
+	// The scoped status replaces the parent's buffered status.
+	if err := s.Flush(); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	if diff := cmp.Diff("STATUS=s: b\n", buf.String()); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifierScopedDisabled(t *testing.T) {
+	var n *sdnotify.Notifier
+	if s := n.Scoped("foo: "); s.Enabled() {
+		t.Fatal("expected disabled Scoped Notifier")
+	}
+}
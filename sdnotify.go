@@ -3,70 +3,774 @@
 package sdnotify
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 // Socket is the predefined systemd notification socket environment variable.
 const Socket = "NOTIFY_SOCKET"
 
+// Environment variables set by systemd for the watchdog, socket activation,
+// and service environment helpers. For a description of each, see:
+// https://www.freedesktop.org/software/systemd/man/sd_watchdog_enabled.html,
+// https://www.freedesktop.org/software/systemd/man/sd_listen_fds.html, and
+// https://www.freedesktop.org/software/systemd/man/systemd.exec.html.
+const (
+	WatchdogUsec         = "WATCHDOG_USEC"
+	WatchdogPID          = "WATCHDOG_PID"
+	ListenFDCount        = "LISTEN_FDS"
+	ListenPID            = "LISTEN_PID"
+	ListenFDNames        = "LISTEN_FDNAMES"
+	InvocationIDEnv      = "INVOCATION_ID"
+	ExecPID              = "SYSTEMD_EXEC_PID"
+	CredentialsDirectory = "CREDENTIALS_DIRECTORY"
+	FDStore              = "FDSTORE"
+)
+
 // Common notification values. For a description of each, see:
 // https://www.freedesktop.org/software/systemd/man/sd_notify.html#Description.
+//
+// Reloading should be sent along with MonotonicUsec; see its documentation for
+// details.
+//
+// Watchdog must be sent periodically by services which set WatchdogSec=, while
+// WatchdogTrigger causes systemd to immediately treat the service as failed.
 const (
-	Ready     = "READY=1"
-	Reloading = "RELOADING=1"
-	Stopping  = "STOPPING=1"
+	Ready           = "READY=1"
+	Reloading       = "RELOADING=1"
+	Stopping        = "STOPPING=1"
+	Watchdog        = "WATCHDOG=1"
+	WatchdogTrigger = "WATCHDOG=trigger"
 )
 
+// BusError creates a BUSERROR notification which reports that the service
+// failed with the input D-Bus error name, such as
+// "org.freedesktop.DBus.Error.TimedOut". BusError returns an error if name is
+// not a well-formed D-Bus error name.
+func BusError(name string) (string, error) {
+	if err := validBusError(name); err != nil {
+		return "", err
+	}
+
+	return "BUSERROR=" + name, nil
+}
+
+// validBusError reports whether name is a valid D-Bus error name: at most 255
+// characters of two or more dot-separated elements, each consisting of ASCII
+// letters, digits, and underscores and not beginning with a digit.
+func validBusError(name string) error {
+	if len(name) > 255 {
+		return fmt.Errorf("sdnotify: D-Bus error name %q is too long", name)
+	}
+
+	elems := strings.Split(name, ".")
+	if len(elems) < 2 {
+		return fmt.Errorf("sdnotify: D-Bus error name %q must contain at least two elements", name)
+	}
+
+	for _, e := range elems {
+		if e == "" {
+			return fmt.Errorf("sdnotify: D-Bus error name %q contains an empty element", name)
+		}
+
+		for i, r := range e {
+			switch {
+			case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r == '_':
+			case r >= '0' && r <= '9' && i > 0:
+			default:
+				return fmt.Errorf("sdnotify: invalid character %q in D-Bus error name %q", r, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Errno creates an ERRNO notification which reports that the service failed
+// with the input errno value, such as 'int(syscall.ENOSPC)'.
+func Errno(errno int) string {
+	return fmt.Sprintf("ERRNO=%d", errno)
+}
+
+// ErrnoErr creates an ERRNO notification from the syscall.Errno wrapped by err.
+// If err does not wrap a syscall.Errno, ErrnoErr returns false.
+func ErrnoErr(err error) (string, bool) {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return "", false
+	}
+
+	return Errno(int(errno)), true
+}
+
+// ExtendTimeout creates an EXTEND_TIMEOUT_USEC notification which requests
+// that systemd extend the current startup, runtime, or shutdown timeout so that
+// it elapses d after the notification is received. ExtendTimeout returns an
+// error if d is not positive.
+//
+// The notification only extends the timeout once, so long-running operations
+// must send another EXTEND_TIMEOUT_USEC notification before each d elapses.
+func ExtendTimeout(d time.Duration) (string, error) {
+	if d <= 0 {
+		return "", fmt.Errorf("sdnotify: non-positive ExtendTimeout duration %s", d)
+	}
+
+	// Round up so that sub-microsecond durations never produce a zero value.
+	return fmt.Sprintf("EXTEND_TIMEOUT_USEC=%d", (d+time.Microsecond-1)/time.Microsecond), nil
+}
+
+// MainPID creates a MAINPID notification which informs systemd of the main
+// process ID of the service, such as a child process spawned by a supervisor.
+//
+// Note that systemd attributes each notification to the PID of the process
+// which sent it, not to the PID of the process which opened the Notifier. With
+// the default NotifyAccess=main, notifications sent by any process other than
+// the main process are rejected, so once the main PID has been changed, the
+// previous main process must not expect further notifications to be accepted
+// unless the unit is configured with NotifyAccess=exec or NotifyAccess=all.
+// The new main process may call New to create its own Notifier.
+func MainPID(pid int) string {
+	return fmt.Sprintf("MAINPID=%d", pid)
+}
+
+// Monotonic creates a MONOTONIC_USEC notification which reports the current
+// CLOCK_MONOTONIC timestamp in microseconds. systemd compares this value
+// against its own monotonic clock, so the wall clock is never consulted.
+//
+// As of systemd v253, a RELOADING notification must be accompanied by a
+// MONOTONIC_USEC notification in the same call to Notify, typically using the
+// time at which the reload began:
+//
+//	n.Notify(sdnotify.Monotonic(), sdnotify.Reloading)
+//
+// Use MonotonicUsec to report the timestamp of an earlier point in time.
+func Monotonic() string {
+	return fmt.Sprintf("MONOTONIC_USEC=%d", monotonicNow().Microseconds())
+}
+
+// MonotonicUsec creates a MONOTONIC_USEC notification which reports the
+// CLOCK_MONOTONIC timestamp corresponding to t in microseconds. See Monotonic
+// for details.
+func MonotonicUsec(t time.Time) string {
+	// Go does not expose its monotonic clock reading, so compute the value
+	// for t relative to the current CLOCK_MONOTONIC value.
+	d := monotonicNow() - time.Since(t)
+	return fmt.Sprintf("MONOTONIC_USEC=%d", d.Microseconds())
+}
+
+// NotifyAccess creates a NOTIFYACCESS notification which changes the unit's
+// NotifyAccess= setting at runtime, as supported by systemd v246+. The access
+// value must be one of "none", "main", "exec", or "all"; NotifyAccess returns
+// an error otherwise.
+func NotifyAccess(access string) (string, error) {
+	switch access {
+	case "none", "main", "exec", "all":
+		return "NOTIFYACCESS=" + access, nil
+	default:
+		return "", fmt.Errorf("sdnotify: invalid NotifyAccess value %q", access)
+	}
+}
+
 // Statusf creates a formatted STATUS notification with the input format string
-// and values.
+// and values. STATUS values must be a single line, so each newline in the
+// formatted value is replaced by a space and each NUL byte is removed.
 func Statusf(format string, v ...interface{}) string {
-	return fmt.Sprintf("STATUS=%s", fmt.Sprintf(format, v...))
+	return "STATUS=" + statusReplacer.Replace(fmt.Sprintf(format, v...))
+}
+
+// StatusDur creates a STATUS notification with the input prefix followed by d
+// in a human-readable format, such as "STATUS=uptime 1 hour 2 minutes 5
+// seconds", so that durations read consistently in STATUS lines. Durations of
+// at least a second are rounded to the nearest second, and shorter durations
+// are rounded to the nearest millisecond. If prefix is empty, only the
+// duration is sent.
+func StatusDur(prefix string, d time.Duration) string {
+	if prefix == "" {
+		return Statusf("%s", formatDuration(d))
+	}
+
+	return Statusf("%s %s", prefix, formatDuration(d))
 }
 
+// formatDuration formats d for StatusDur.
+func formatDuration(d time.Duration) string {
+	var neg string
+	if d < 0 {
+		neg, d = "-", -d
+	}
+
+	unit := func(v int64, name string) string {
+		if v == 1 {
+			return "1 " + name
+		}
+
+		return strconv.FormatInt(v, 10) + " " + name + "s"
+	}
+
+	if ms := d.Round(time.Millisecond); ms < time.Second {
+		return neg + unit(int64(ms/time.Millisecond), "millisecond")
+	}
+
+	d = d.Round(time.Second)
+	var parts []string
+	if h := int64(d / time.Hour); h > 0 {
+		parts = append(parts, unit(h, "hour"))
+	}
+	if m := int64(d % time.Hour / time.Minute); m > 0 {
+		parts = append(parts, unit(m, "minute"))
+	}
+	if sec := int64(d % time.Minute / time.Second); sec > 0 {
+		parts = append(parts, unit(sec, "second"))
+	}
+
+	return neg + strings.Join(parts, " ")
+}
+
+// statusReplacer makes a value safe for use in a STATUS notification.
+var statusReplacer = strings.NewReplacer("\n", " ", "\x00", "")
+
+// Interface is the set of Notifier methods most programs depend on. It allows
+// callers to substitute a fake implementation in tests.
+type Interface interface {
+	Notify(s ...string) error
+	Close() error
+}
+
+var (
+	_ Interface = &Notifier{}
+	_ Interface = Nop{}
+)
+
+// Nop is an Interface which discards all notifications.
+type Nop struct{}
+
+// Notify implements Interface.
+func (Nop) Notify(_ ...string) error { return nil }
+
+// Close implements Interface.
+func (Nop) Close() error { return nil }
+
 // A Notifier can notify systemd of service status and readiness. Any methods
-// called on a nil Notifier will result in a no-op, allowing graceful
-// functionality degradation when a Go program is not running under systemd
-// supervision.
-type Notifier struct{ wc io.WriteCloser }
+// called on a nil or Disabled Notifier will result in a no-op, allowing
+// graceful functionality degradation when a Go program is not running under
+// systemd supervision.
+//
+// A Notifier is safe for concurrent use. Each call to a Notifier method sends
+// its notifications with a single write, so notifications from concurrent
+// calls are never interleaved. On a datagram socket, each call sends exactly
+// one datagram, unless Notify must split notifications which exceed the size
+// systemd accepts across several, between which notifications from concurrent
+// calls may be interleaved.
+//
+// Writes are serialized, so notifications are sent in the order in which their
+// calls begin writing, and calls made by a single goroutine are always sent in
+// order. Background senders such as StartWatchdog and KeepAlive may safely run
+// at the same time; their notifications are sent whole, each returning its
+// error to the caller which sent it.
+type Notifier struct {
+	// mu serializes writes and deadline changes on wc. Reset also holds
+	// connMu while replacing wc, so that methods which only inspect wc need
+	// not wait for writes.
+	mu     sync.Mutex
+	connMu sync.RWMutex
+	wc     io.WriteCloser
+
+	// creds, if set, are sent as SCM_CREDENTIALS with each notification.
+	creds *ucred
+
+	// stream indicates wc is a stream connection which requires framing.
+	stream bool
+
+	// retries and backoff configure retries of transient errors.
+	retries int
+	backoff time.Duration
+
+	// logger and metrics, if set, observe each notification.
+	logger  *slog.Logger
+	metrics Metrics
+
+	// timeout, if set, bounds each write to wc.
+	timeout time.Duration
+
+	// sendBuffer, if sendBufferSet, is the SO_SNDBUF size applied to wc when
+	// the Notifier is opened.
+	sendBuffer    int
+	sendBufferSet bool
+
+	// sock is the socket path, removed on Close if unlink is set.
+	sock   string
+	unlink bool
+
+	// last and lastTime record the most recently sent notifications.
+	last     []string
+	lastTime time.Time
+
+	// statusInterval rate limits STATUS notifications. rlMu guards the time
+	// the last status was sent and the pending status which rlTimer sends.
+	statusInterval time.Duration
+	rlMu           sync.Mutex
+	lastStatus     time.Time
+	pending        string
+	rlTimer        *time.Timer
+
+	// jitter randomizes watchdog intervals.
+	jitter float64
+
+	// startupExtension configures StartupContext, and endStartup stops its
+	// extensions.
+	startupExtension time.Duration
+	endStartup       func()
+
+	// dryRun records each message in sent in place of writing to wc.
+	dryRun bool
+	sent   []string
+
+	// errMu guards the result of the most recent background notification and
+	// the channel returned by Errors, which is closed with the Notifier.
+	errMu     sync.Mutex
+	asyncErr  error
+	errC      chan error
+	errClosed bool
+
+	// readyMu serializes ReadyOnce, and readySent records whether it has
+	// sent Ready.
+	readyMu   sync.Mutex
+	readySent bool
+
+	// stopOnClose sends Stopping before Close closes wc.
+	stopOnClose bool
+
+	// separate sends each notification in its own datagram.
+	separate bool
+
+	// flushOnClose flushes buffered notifications and waits for a barrier
+	// before Close closes wc.
+	flushOnClose bool
+
+	// buffered enables buffering of notifications in buf until Flush.
+	buffered bool
+	bufMu    sync.Mutex
+	buf      []string
+
+	// unsetEnv causes New to unset NOTIFY_SOCKET.
+	unsetEnv bool
+
+	// journalFallback, if set, is the journal socket used by New when
+	// NOTIFY_SOCKET is unset. journal indicates wc is connected to it.
+	journalFallback string
+	journal         bool
+
+	// env, if set, replaces os.Getenv for reading environment variables.
+	env func(key string) string
+
+	// sockets holds the descriptors converted by Listeners and PacketConns
+	// when env is set.
+	sockets inheritedSockets
+
+	// parent, if set, is the Notifier whose connection a Scoped Notifier
+	// uses in place of wc. prefix is prepended to STATUS values by Scoped
+	// Notifiers and WithStatusPrefix.
+	parent *Notifier
+	prefix string
+
+	// multi, if set, holds the Notifiers which a Multi Notifier forwards to
+	// in place of wc.
+	multi []*Notifier
+}
+
+// Disabled returns a non-nil Notifier which does not send any notifications,
+// as if NOTIFY_SOCKET were unset. It is useful for injecting a Notifier into
+// code which does not require systemd notifications, such as tests.
+func Disabled() *Notifier { return &Notifier{} }
 
 // New creates a Notifier which sends notifications to the UNIX socket specified
 // by the NOTIFY_SOCKET environment variable. See Open for more details.
-func New() (*Notifier, error) {
-	s := os.Getenv(Socket)
+//
+// If NOTIFY_SOCKET is unset or empty, New returns an error which can be checked
+// with 'errors.Is(err, os.ErrNotExist)', unless WithJournalFallback is set and
+// the journal socket exists.
+//
+// On platforms other than Linux, where systemd is unavailable, New returns a
+// Disabled Notifier and no error so that cross-platform programs need not
+// special-case it. Operations which pass file descriptors or credentials, such
+// as Store and OpenPID, report an error on those platforms.
+func New(opts ...Option) (*Notifier, error) {
+	var (
+		n   *Notifier
+		err error
+	)
+
+	// Check the options which affect New itself before creating n.
+	probe := (&Notifier{}).apply(opts)
+
+	s, ok := os.LookupEnv(Socket)
+	if empty := supported && ok && s == ""; empty && !probe.dryRun && probe.journalFallback == "" {
+		// Treat an empty socket as unset, but report that it was set.
+		err = fmt.Errorf("sdnotify: %s is set but empty: %w", Socket, os.ErrNotExist)
+	} else {
+		n, err = NewFromEnv(os.Getenv, opts...)
+	}
+
+	if probe.unsetEnv {
+		// The socket has been captured or found unusable; either way, child
+		// processes must not inherit it.
+		if uerr := os.Unsetenv(Socket); uerr != nil && err == nil {
+			return nil, uerr
+		}
+	}
+
+	return n, err
+}
+
+// NewFromEnv is like New, but reads NOTIFY_SOCKET and any other environment
+// variables used by the Notifier, such as WATCHDOG_USEC, using getenv instead
+// of the process environment. This is useful for tests and for supervisors
+// which manage the environments of their children. Methods which read the
+// environment, such as n.WatchdogEnabled and n.ListenFDs, also use getenv. To
+// use a map, pass a function such as:
+//
+//	func(key string) string { return env[key] }
+func NewFromEnv(getenv func(key string) string, opts ...Option) (*Notifier, error) {
+	if isDryRun(opts) {
+		n := openDryRun(opts)
+		n.env = getenv
+		return n, nil
+	}
+	if !supported {
+		// systemd only runs on Linux, so there is nothing to notify.
+		return Disabled(), nil
+	}
+
+	s := getenv(Socket)
 	if s == "" {
+		if js := (&Notifier{}).apply(opts).journalFallback; js != "" {
+			return openJournal(js, opts)
+		}
+
 		// Don't bother stat'ing an empty socket, just return now.
 		return nil, os.ErrNotExist
 	}
 
-	return Open(s)
+	n, err := Open(s, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	n.env = getenv
+	return n, nil
 }
 
 // Open creates a Notifier which sends notifications to the UNIX socket
-// specified by sock.
+// specified by sock. If sock begins with '@', it refers to a Linux abstract
+// namespace socket, and the '@' is replaced by a NUL byte when connecting.
 //
 // If sock does not exist or is unset (meaning the service is not running under
 // systemd supervision, or is not using systemd unit Type=notify), Open will
 // return an error which can be checked with 'errors.Is(err, os.ErrNotExist)'.
 // Calling any of the resulting nil Notifier's methods will result in a no-op.
-func Open(sock string) (*Notifier, error) {
+//
+// Open returns an error if sock is neither an absolute path nor an abstract
+// socket name, as systemd never uses relative socket paths.
+//
+// Open connects to a datagram socket as systemd uses. If sock is instead a
+// stream socket, as created by some test environments, Open falls back to
+// connecting as with OpenType and the "unix" network.
+//
+// Zero or more Options may be specified to configure the Notifier. With no
+// Options, the Notifier uses the default behavior described by each Option.
+func Open(sock string, opts ...Option) (*Notifier, error) {
+	return OpenContext(context.Background(), sock, opts...)
+}
+
+// OpenContext is like Open, but bounds the time spent connecting to sock by
+// ctx. If ctx is canceled or its deadline is exceeded before the connection is
+// established, OpenContext returns an error which wraps ctx.Err().
+func OpenContext(ctx context.Context, sock string, opts ...Option) (*Notifier, error) {
+	n, err := openType(ctx, sock, "unixgram", opts)
+	if errors.Is(err, syscall.EPROTOTYPE) {
+		// sock is not a datagram socket, so try a stream socket instead.
+		return openType(ctx, sock, "unix", opts)
+	}
+
+	return n, err
+}
+
+// OpenType is like Open, but connects to sock using the specified network,
+// which must be "unixgram" or "unix". systemd always uses a datagram socket,
+// but some container runtimes proxy the notification socket over a stream
+// connection.
+//
+// On a "unix" stream socket there are no message boundaries, so each call to a
+// Notifier method writes its notifications followed by a newline to separate
+// them from the notifications of later calls. Stream writes are not atomic: a
+// failed write may leave only part of a call's notifications sent.
+func OpenType(sock, network string, opts ...Option) (*Notifier, error) {
+	return openType(context.Background(), sock, network, opts)
+}
+
+// openType implements OpenType, bounding the dial by ctx.
+func openType(ctx context.Context, sock, network string, opts []Option) (*Notifier, error) {
+	switch network {
+	case "unixgram", "unix":
+	default:
+		return nil, fmt.Errorf("sdnotify: unsupported notify socket network %q", network)
+	}
+	if isDryRun(opts) {
+		return openDryRun(opts), nil
+	}
+
+	c, addr, err := dial(ctx, network, sock)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Notifier{
+		wc:     c,
+		stream: network == "unix",
+		sock:   addr,
+	}
+
+	return n.apply(opts).applySendBuffer()
+}
+
+// OpenWriter creates a Notifier which writes notifications to w instead of a
+// socket. Each call to Notify writes its notifications followed by a newline,
+// as with a "unix" stream socket from OpenType. This is useful for mirroring
+// notifications to a log or capturing them in tests.
+//
+// Closing the Notifier does not close w.
+func OpenWriter(w io.Writer, opts ...Option) *Notifier {
+	n := &Notifier{
+		wc:     nopCloser{w},
+		stream: true,
+	}
+
+	return n.apply(opts)
+}
+
+// OpenConn creates a Notifier which sends notifications over the existing,
+// connected socket c, such as one inherited from a sandbox which cannot reach
+// the notify socket's path. If c is a "unixgram" socket, notifications are
+// sent as datagrams; otherwise they are framed as with a "unix" stream socket
+// from OpenType.
+//
+// Closing the Notifier closes c, but never removes a socket file.
+func OpenConn(c net.Conn, opts ...Option) *Notifier {
+	n := &Notifier{
+		wc:     c,
+		stream: c.LocalAddr().Network() != "unixgram",
+	}
+
+	return n.apply(opts)
+}
+
+// OpenFD is like OpenConn, but creates a Notifier from the connected socket
+// file descriptor fd. fd is duplicated, so the caller remains responsible for
+// closing it.
+func OpenFD(fd int, opts ...Option) (*Notifier, error) {
+	// Duplicate fd so that closing f leaves the caller's descriptor open.
+	dfd, err := dup(fd, true)
+	if err != nil {
+		return nil, fmt.Errorf("sdnotify: invalid notify socket descriptor %d: %w", fd, err)
+	}
+
+	f := os.NewFile(uintptr(dfd), "notify")
+	defer f.Close()
+
+	c, err := net.FileConn(f)
+	if err != nil {
+		return nil, fmt.Errorf("sdnotify: failed to open notify socket descriptor %d: %w", fd, err)
+	}
+
+	return OpenConn(c, opts...).applySendBuffer()
+}
+
+// DupFD returns a duplicate of the Notifier's socket file descriptor which is
+// not marked close-on-exec, so that it survives when the process re-executes
+// itself, such as for a zero-downtime restart. The new process may pass the
+// descriptor to OpenFD to continue sending notifications on the same socket.
+// The caller is responsible for closing the descriptor.
+//
+// DupFD returns an error which can be checked with
+// 'errors.Is(err, os.ErrNotExist)' if n is nil or Disabled, and an error if n
+// does not use a socket, such as a Notifier created by OpenWriter.
+func (n *Notifier) DupFD() (int, error) {
+	if n.disabled() {
+		return 0, fmt.Errorf("sdnotify: cannot duplicate socket: %w", os.ErrNotExist)
+	}
+	if n.parent != nil {
+		return n.parent.DupFD()
+	}
+
+	n.connMu.RLock()
+	defer n.connMu.RUnlock()
+
+	sc, ok := n.wc.(syscall.Conn)
+	if !ok {
+		return 0, errors.New("sdnotify: notifier has no socket to duplicate")
+	}
+
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		dfd  int
+		derr error
+	)
+
+	if err := rc.Control(func(fd uintptr) {
+		dfd, derr = dup(int(fd), false)
+	}); err != nil {
+		return 0, err
+	}
+	if derr != nil {
+		return 0, os.NewSyscallError("dup", derr)
+	}
+
+	return dfd, nil
+}
+
+// setPassCred enables SO_PASSCRED on c.
+func setPassCred(c net.Conn) error {
+	sc, ok := c.(syscall.Conn)
+	if !ok {
+		return errNoControl
+	}
+
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		serr = setsockoptPassCred(fd)
+	}); err != nil {
+		return err
+	}
+
+	return os.NewSyscallError("setsockopt", serr)
+}
+
+// A nopCloser is an io.WriteCloser whose Close method is a no-op.
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// OpenPID is like Open, but each notification sent by the Notifier is
+// attributed to the process specified by pid, as with systemd's
+// sd_pid_notify. This is useful for supervisor processes which relay
+// notifications on behalf of their children.
+//
+// The process's PID, UID, and GID are sent as SCM_CREDENTIALS ancillary data
+// and are validated by the kernel: sending a PID other than that of the
+// current process requires CAP_SYS_ADMIN in the PID namespace of the target
+// process. systemd enables SO_PASSCRED on its notification socket, which is
+// required for the receiver to observe the credentials. OpenPID also enables
+// SO_PASSCRED on the sending socket, so callers need not configure it.
+func OpenPID(sock string, pid int, opts ...Option) (*Notifier, error) {
+	c, addr, err := dial(context.Background(), "unixgram", sock)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setPassCred(c); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	n := &Notifier{
+		wc:    c,
+		sock:  addr,
+		creds: newUcred(pid),
+	}
+
+	return n.apply(opts).applySendBuffer()
+}
+
+// ParseSocket parses and validates the notification socket address s, as
+// found in NOTIFY_SOCKET, after trimming any surrounding whitespace. An
+// absolute path or a Linux abstract namespace socket name beginning with '@'
+// produces the "unixgram" network and the address to dial. A "vsock:CID:PORT"
+// address, as used by systemd for virtual machines, produces the "vsock" network
+// and "CID:PORT", but cannot be dialed by this package.
+//
+// If s is empty, ParseSocket returns an error which can be checked with
+// 'errors.Is(err, os.ErrNotExist)'. Any other address is rejected, as systemd
+// never uses relative socket paths.
+func ParseSocket(s string) (network, addr string, err error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return "", "", fmt.Errorf("sdnotify: notify socket path is empty: %w", os.ErrNotExist)
+	case s == "@":
+		return "", "", errors.New("sdnotify: notify socket abstract name is empty")
+	// Socket paths use '/' even when parsed on other platforms.
+	case strings.HasPrefix(s, "@"), strings.HasPrefix(s, "/"):
+		return "unixgram", s, nil
+	}
+
+	if a, ok := strings.CutPrefix(s, "vsock:"); ok {
+		cid, port, ok := strings.Cut(a, ":")
+		if _, err := strconv.ParseUint(cid, 10, 32); !ok || err != nil {
+			return "", "", fmt.Errorf("sdnotify: invalid vsock notify socket %q", s)
+		}
+		if _, err := strconv.ParseUint(port, 10, 32); err != nil {
+			return "", "", fmt.Errorf("sdnotify: invalid vsock notify socket %q", s)
+		}
+
+		return "vsock", a, nil
+	}
+
+	return "", "", fmt.Errorf("sdnotify: notify socket %q must be an absolute path or begin with '@'", s)
+}
+
+// dial validates and connects to the notification socket sock using network,
+// returning the connection and the address parsed from sock by ParseSocket.
+func dial(ctx context.Context, network, sock string) (net.Conn, string, error) {
+	// systemd only sets NOTIFY_SOCKET to an absolute path or an abstract
+	// socket name, so anything else is a configuration error rather than an
+	// indication that the service isn't running under systemd.
+	pnet, sock, err := ParseSocket(sock)
+	if err != nil {
+		return nil, "", err
+	}
+	if pnet != "unixgram" {
+		return nil, "", fmt.Errorf("sdnotify: unsupported %s notify socket %q", pnet, sock)
+	}
+
 	// Don't stat Linux abstract namespace sockets, as would be created with a
-	// net.ListenPacket with no path.
+	// net.ListenPacket with no path. The net package handles the translation
+	// of the leading '@' to a NUL byte.
 	if !strings.HasPrefix(sock, "@") {
 		if _, err := os.Stat(sock); err != nil {
-			return nil, fmt.Errorf("failed to stat notify socket: %w", err)
+			return nil, "", fmt.Errorf("failed to stat notify socket: %w", err)
 		}
 	}
 
-	c, err := net.Dial("unixgram", sock)
+	var d net.Dialer
+	c, err := d.DialContext(ctx, network, sock)
 	if err != nil {
-		return nil, err
+		if cerr := ctx.Err(); cerr != nil {
+			return nil, "", fmt.Errorf("sdnotify: failed to connect to notify socket %q: %w", sock, cerr)
+		}
+
+		return nil, "", err
 	}
 
-	return &Notifier{wc: c}, nil
+	return c, sock, nil
 }
 
 // Notify sends zero or more notifications to systemd. See the package constants
@@ -76,21 +780,633 @@ func Open(sock string) (*Notifier, error) {
 // For advanced use cases, see:
 // https://www.freedesktop.org/software/systemd/man/sd_notify.html#Description.
 //
-// If n is nil or no strings are specified, Notify is a no-op.
+// Each string must be a KEY=value assignment with a single-line value, or
+// Notify returns an error identifying the invalid string. Use NotifyRaw to
+// bypass this validation.
+//
+// On a datagram socket, all of the strings are sent atomically in a single
+// datagram: either every notification is sent or none are, and a datagram is
+// never truncated. systemd discards datagrams larger than 4096 bytes, so if
+// the notifications exceed that size, they are instead split across multiple
+// datagrams sent in order, each holding only complete notifications. If a
+// single notification exceeds that size, Notify returns an error which wraps
+// syscall.EMSGSIZE without sending anything. See OpenType for the behavior of
+// stream sockets.
+//
+// Notifications are sent in the order they are specified and are never
+// reordered. systemd applies the assignments in a datagram in order, so
+// callers should place STATUS and ERRNO before the state change which they
+// describe, and MONOTONIC_USEC immediately before RELOADING. NotifyState always
+// sends its notifications in this order.
+//
+// If n is nil or Disabled, or no strings are specified, Notify is a no-op.
 func (n *Notifier) Notify(s ...string) error {
-	if n == nil || len(s) == 0 {
+	return n.NotifyContext(context.Background(), s...)
+}
+
+// NotifyContext is like Notify, but the write to the socket is bounded by ctx.
+// If ctx is canceled or its deadline is exceeded before the notifications can
+// be sent, NotifyContext returns ctx.Err().
+func (n *Notifier) NotifyContext(ctx context.Context, s ...string) error {
+	if n.disabled() || len(s) == 0 {
 		return nil
 	}
 
-	_, err := io.WriteString(n.wc, strings.Join(s, "\n"))
+	for i, ss := range s {
+		if err := validate(ss); err != nil {
+			return fmt.Errorf("sdnotify: invalid notification %d %q: %w", i, ss, err)
+		}
+	}
+
+	if n.parent != nil {
+		// Rate limiting and buffering are applied by the root Notifier.
+		return n.parent.NotifyContext(ctx, n.applyPrefix(s)...)
+	}
+	if endsStartup(s) {
+		n.stopStartup()
+	}
+
+	if n.statusInterval > 0 {
+		if s = n.rateLimit(s); len(s) == 0 {
+			return nil
+		}
+	}
+
+	return n.deliver(ctx, s)
+}
+
+// deliver sends the validated notifications in s, or buffers them if n is
+// configured using WithBuffering.
+func (n *Notifier) deliver(ctx context.Context, s []string) error {
+	if n.buffered {
+		return n.buffer(ctx, s)
+	}
+
+	return n.notify(ctx, s)
+}
+
+// NotifyRaw is like Notify, but does not validate the input strings. It is
+// intended for advanced use cases which must send notifications that Notify
+// would reject.
+func (n *Notifier) NotifyRaw(s ...string) error {
+	if n.disabled() || len(s) == 0 {
+		return nil
+	}
+	if endsStartup(s) {
+		n.stopStartup()
+	}
+
+	return n.notify(context.Background(), s)
+}
+
+// validate checks that s is a well-formed KEY=value notification, where KEY
+// consists of uppercase letters, digits, and underscores, and value is a single
+// line containing no NUL bytes.
+func validate(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok {
+		return errors.New("missing '=' separator")
+	}
+	if k == "" {
+		return errors.New("empty key")
+	}
+
+	for i, r := range k {
+		switch {
+		case r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return fmt.Errorf("invalid character %q in key", r)
+		}
+	}
+
+	if i := strings.IndexAny(v, "\n\x00"); i != -1 {
+		return fmt.Errorf("invalid character %q in value", v[i])
+	}
+
+	return nil
+}
+
+// maxDatagram is the largest notification datagram systemd will accept, as
+// defined by NOTIFY_BUFFER_MAX (PIPE_BUF) in systemd's service manager. Larger
+// datagrams are truncated and discarded by systemd.
+const maxDatagram = 4096
+
+// notify sends the notifications in s with a single write.
+func (n *Notifier) notify(ctx context.Context, s []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s = n.applyPrefix(s)
+	if n.parent != nil {
+		return n.parent.notify(ctx, s)
+	}
+	if n.multi != nil {
+		return n.notifyMulti(ctx, s)
+	}
+	if n.journal {
+		return n.notifyJournal(ctx, s)
+	}
+
+	// Encode into a pooled buffer so that frequent notifications such as
+	// Watchdog do not allocate.
+	bp := encodePool.Get().(*[]byte)
+	defer putEncodeBuffer(bp)
+
+	b := appendEncode((*bp)[:0], s)
+	*bp = b
+
+	// Don't rely on the kernel's limit, which varies with the socket's send
+	// buffer size and greatly exceeds what systemd will accept.
+	switch {
+	case n.separate && !n.stream && len(s) > 1:
+		if err := n.writeSeparate(ctx, s); err != nil {
+			return err
+		}
+	case n.stream || len(b) <= maxDatagram:
+		if err := n.writeDatagram(ctx, b); err != nil {
+			return err
+		}
+	default:
+		ss, ok := splitDatagrams(s)
+		if !ok {
+			return fmt.Errorf("sdnotify: %d byte notification exceeds maximum size of %d bytes: %w",
+				len(b), maxDatagram, syscall.EMSGSIZE)
+		}
+
+		// systemd applies separate datagrams cumulatively, so sending each
+		// in order has the same effect as a single datagram.
+		for _, s := range ss {
+			if err := n.writeDatagram(ctx, Encode(s...)); err != nil {
+				return err
+			}
+		}
+	}
+
+	n.mu.Lock()
+	n.setLast(s)
+	n.mu.Unlock()
+
+	return nil
+}
+
+// writeDatagram writes the encoded notifications b and reports the result to
+// any logger and metrics.
+func (n *Notifier) writeDatagram(ctx context.Context, b []byte) error {
+	err := n.write(ctx, b)
+	n.logSent(ctx, b, err)
+	n.observe(b, err)
+	if errors.Is(err, syscall.EMSGSIZE) {
+		return fmt.Errorf("sdnotify: %d byte notification exceeds maximum datagram size: %w", len(b), err)
+	}
+
 	return err
 }
 
-// Close closes the Notifier's socket. If n is nil, Close is a no-op.
+// writeSeparate sends each notification in s as its own datagram for
+// WithSeparateDatagrams, except that a MONOTONIC_USEC notification is always
+// sent along with the notification which follows it. Every datagram is
+// attempted, and their errors are joined.
+func (n *Notifier) writeSeparate(ctx context.Context, s []string) error {
+	var errs []error
+	for i := 0; i < len(s); i++ {
+		unit := s[i : i+1]
+		if strings.HasPrefix(s[i], "MONOTONIC_USEC=") && i+1 < len(s) {
+			unit = s[i : i+2]
+			i++
+		}
+
+		b := Encode(unit...)
+		if len(b) > maxDatagram {
+			errs = append(errs, fmt.Errorf("sdnotify: %d byte notification exceeds maximum size of %d bytes: %w",
+				len(b), maxDatagram, syscall.EMSGSIZE))
+			continue
+		}
+
+		if err := n.writeDatagram(ctx, b); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// encodePool holds buffers for encoding notifications.
+var encodePool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 128)
+		return &b
+	},
+}
+
+// putEncodeBuffer returns bp to encodePool, unless it has grown too large to be
+// worth keeping.
+func putEncodeBuffer(bp *[]byte) {
+	if cap(*bp) > maxDatagram {
+		return
+	}
+
+	*bp = (*bp)[:0]
+	encodePool.Put(bp)
+}
+
+// appendEncode appends the encoding of ss, as produced by Encode, to b.
+func appendEncode(b []byte, ss []string) []byte {
+	for i, s := range ss {
+		if i > 0 {
+			b = append(b, '\n')
+		}
+		b = append(b, s...)
+	}
+
+	return b
+}
+
+// splitDatagrams splits the notifications in s into groups which each fit in
+// a single datagram, preserving their order. A MONOTONIC_USEC notification is
+// never separated from the notification which follows it, typically
+// Reloading. If any notification is too large to send on its own,
+// splitDatagrams returns false.
+func splitDatagrams(s []string) ([][]string, bool) {
+	var (
+		ss   [][]string
+		cur  []string
+		size int
+	)
+
+	for i := 0; i < len(s); i++ {
+		unit := s[i : i+1]
+		if strings.HasPrefix(s[i], "MONOTONIC_USEC=") && i+1 < len(s) {
+			unit = s[i : i+2]
+			i++
+		}
+
+		usize := len(Encode(unit...))
+		if usize > maxDatagram {
+			return nil, false
+		}
+
+		// Account for the newline which separates unit from cur.
+		if len(cur) > 0 && size+1+usize > maxDatagram {
+			ss = append(ss, cur)
+			cur, size = nil, 0
+		}
+		if len(cur) > 0 {
+			size++
+		}
+
+		cur = append(cur, unit...)
+		size += usize
+	}
+
+	return append(ss, cur), true
+}
+
+// Ready sends a STATUS notification with the input status and a Ready
+// notification in a single datagram. If status is empty, only the Ready
+// notification is sent.
+func (n *Notifier) Ready(status string) error {
+	return n.Notify(withStatus(status, Ready)...)
+}
+
+// ReadyOnce sends a Ready notification the first time it is called and is a
+// no-op thereafter, so that startup code with several paths which may each
+// declare readiness sends Ready only once. Concurrent calls wait for the first
+// to complete. If sending fails, the error is returned and a later call will
+// try again. Scoped Notifiers share this state with their parent.
+func (n *Notifier) ReadyOnce() error {
+	if n.disabled() {
+		return nil
+	}
+	if n.parent != nil {
+		return n.parent.ReadyOnce()
+	}
+
+	n.readyMu.Lock()
+	defer n.readyMu.Unlock()
+
+	if n.readySent {
+		return nil
+	}
+
+	if err := n.Ready(""); err != nil {
+		return err
+	}
+
+	n.readySent = true
+	return nil
+}
+
+// Stop sends a STATUS notification with the input status and a Stopping
+// notification in a single datagram. If status is empty, only the Stopping
+// notification is sent.
+func (n *Notifier) Stop(status string) error {
+	return n.Notify(withStatus(status, Stopping)...)
+}
+
+// Encode serializes notifications in the format expected by systemd: each
+// notification is separated by a newline, with no trailing newline. It is
+// useful for programs which send notifications over their own transport.
+func Encode(ss ...string) []byte {
+	return []byte(strings.Join(ss, "\n"))
+}
+
+// Failf sends a formatted STATUS notification, an ERRNO notification with the
+// input errno value, and a Stopping notification in a single datagram. It is
+// typically used to report why a service is exiting after failing to start.
+func (n *Notifier) Failf(errno int, format string, a ...interface{}) error {
+	return n.Notify(Statusf(format, a...), Errno(errno), Stopping)
+}
+
+// Progress sends a STATUS notification which reports progress through a known
+// amount of work in a consistent format, such as "STATUS=loaded shards (4/10)".
+// If total is zero or negative, the amount of work is unknown and only msg is
+// sent. If msg is empty, only the progress is sent, as in "STATUS=4/10".
+func (n *Notifier) Progress(current, total int, msg string) error {
+	switch {
+	case total <= 0:
+		return n.Notify(Statusf("%s", msg))
+	case msg == "":
+		return n.Notify(Statusf("%d/%d", current, total))
+	default:
+		return n.Notify(Statusf("%s (%d/%d)", msg, current, total))
+	}
+}
+
+// withStatus prepends a STATUS notification for status to ss, unless status is
+// empty.
+func withStatus(status string, ss ...string) []string {
+	if status == "" {
+		return ss
+	}
+
+	return append([]string{"STATUS=" + status}, ss...)
+}
+
+// A deadliner is a connection which supports write deadlines.
+type deadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// write writes b to the socket, applying a write deadline derived from ctx if
+// the socket supports it.
+func (n *Notifier) write(ctx context.Context, b []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.timeout)
+		defer cancel()
+	}
+
+	dc, ok := n.wc.(deadliner)
+	if !ok || ctx.Done() == nil {
+		// No deadline support or the context can never be canceled.
+		return n.sendRetry(ctx, b, nil)
+	}
+
+	if d, ok := ctx.Deadline(); ok {
+		if err := dc.SetWriteDeadline(d); err != nil {
+			return err
+		}
+	}
+
+	// Interrupt a blocked write immediately if ctx is canceled.
+	var (
+		stopC = make(chan struct{})
+		doneC = make(chan struct{})
+	)
+
+	go func() {
+		defer close(doneC)
+
+		select {
+		case <-ctx.Done():
+			_ = dc.SetWriteDeadline(time.Unix(1, 0))
+		case <-stopC:
+		}
+	}()
+
+	err := n.sendRetry(ctx, b, nil)
+	close(stopC)
+	<-doneC
+
+	// Clear the deadline for future writes.
+	if derr := dc.SetWriteDeadline(time.Time{}); err == nil {
+		err = derr
+	}
+
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		// The only deadlines are derived from ctx, which may not yet report
+		// its own expiry due to timer granularity.
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// LocalAddr returns the local address of the Notifier's socket. If n is nil
+// or Disabled, LocalAddr returns nil.
+func (n *Notifier) LocalAddr() net.Addr {
+	if c, ok := n.conn(); ok {
+		return c.LocalAddr()
+	}
+
+	return nil
+}
+
+// RemoteAddr returns the address of the notification socket the Notifier is
+// connected to. If n is nil or Disabled, RemoteAddr returns nil.
+func (n *Notifier) RemoteAddr() net.Addr {
+	if c, ok := n.conn(); ok {
+		return c.RemoteAddr()
+	}
+
+	return nil
+}
+
+// conn returns the Notifier's socket as a net.Conn, if possible.
+func (n *Notifier) conn() (net.Conn, bool) {
+	if n.disabled() {
+		return nil, false
+	}
+	if n.parent != nil {
+		return n.parent.conn()
+	}
+
+	n.connMu.RLock()
+	defer n.connMu.RUnlock()
+
+	c, ok := n.wc.(net.Conn)
+	return c, ok
+}
+
+// ErrSocketGone is returned when the notification socket can no longer be
+// reached, such as when systemd has been restarted or the socket path has been
+// removed. Errors wrapping ErrSocketGone also wrap the underlying errno.
+var ErrSocketGone = errors.New("sdnotify: notification socket is unavailable")
+
+// IsSocketUnavailable reports whether err indicates that the notification
+// socket can no longer be reached. Callers such as watchdog loops may use it to
+// stop sending notifications rather than retrying indefinitely.
+func IsSocketUnavailable(err error) bool { return errors.Is(err, ErrSocketGone) }
+
+// socketErr wraps err with ErrSocketGone if it indicates the peer socket is
+// no longer present.
+func socketErr(err error) error {
+	for _, errno := range []syscall.Errno{
+		syscall.ECONNREFUSED,
+		syscall.ECONNRESET,
+		syscall.ENOENT,
+		syscall.ENOTCONN,
+		syscall.EPIPE,
+	} {
+		if errors.Is(err, errno) {
+			return fmt.Errorf("%w: %w", ErrSocketGone, err)
+		}
+	}
+
+	return err
+}
+
+// errNoControl is returned when a Notifier cannot send control messages.
+var errNoControl = errors.New("sdnotify: notifier cannot send control messages")
+
+// send writes b to the socket with oob as ancillary data, along with any
+// credentials configured for n. The caller must hold n.mu.
+func (n *Notifier) send(b, oob []byte) error {
+	if n.dryRun {
+		n.sent = append(n.sent, string(b))
+		return nil
+	}
+	if n.stream {
+		// Terminate every message, including those with control messages,
+		// so it cannot run into the next.
+		b = append(b[:len(b):len(b)], '\n')
+	}
+	if n.creds != nil {
+		oob = append(credsOOB(n.creds), oob...)
+	}
+	if len(oob) == 0 {
+		_, err := n.wc.Write(b)
+		return err
+	}
+
+	sc, ok := n.wc.(syscall.Conn)
+	if !ok {
+		return errNoControl
+	}
+
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	// The net package does not permit WriteMsgUnix on a connected datagram
+	// socket, so send the message on the raw socket instead.
+	var serr error
+	err = rc.Write(func(fd uintptr) bool {
+		serr = sendmsg(fd, b, oob)
+		return serr != syscall.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.NewSyscallError("sendmsg", serr)
+}
+
+// Close closes the Notifier's socket. If n is nil or Disabled, Close is a
+// no-op.
 func (n *Notifier) Close() error {
-	if n == nil {
+	if n.disabled() {
 		return nil
 	}
 
-	return n.wc.Close()
+	if n.parent != nil {
+		// The parent owns the connection.
+		return nil
+	}
+	// No more background errors will be reported once n is closed.
+	defer n.closeErrors()
+
+	if n.multi != nil {
+		return n.forEach((*Notifier).Close)
+	}
+
+	// Don't lose a status held back by rate limiting.
+	serr := n.flushStatus()
+	if n.flushOnClose {
+		if err := n.Flush(); serr == nil {
+			serr = err
+		}
+	}
+	if n.stopOnClose {
+		if err := n.Notify(Stopping); serr == nil {
+			serr = err
+		}
+	}
+	if n.flushOnClose {
+		if err := n.closeBarrier(); serr == nil {
+			serr = err
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	err := n.wc.Close()
+	if err == nil {
+		err = serr
+	}
+	if n.unlink && n.sock != "" && !strings.HasPrefix(n.sock, "@") {
+		if rerr := os.Remove(n.sock); rerr != nil && !errors.Is(rerr, os.ErrNotExist) && err == nil {
+			err = rerr
+		}
+	}
+
+	return err
+}
+
+func panicf(format string, a ...interface{}) {
+	panic(fmt.Sprintf(format, a...))
+}
+
+// Enabled reports whether n will send notifications to systemd or another
+// destination. Enabled returns false for a nil or Disabled Notifier, such as
+// when New is called without NOTIFY_SOCKET set.
+func (n *Notifier) Enabled() bool { return !n.disabled() }
+
+// getenv reads the environment variable key from n's environment.
+func (n *Notifier) getenv(key string) string {
+	if n == nil {
+		return os.Getenv(key)
+	}
+	if n.parent != nil {
+		return n.parent.getenv(key)
+	}
+	if n.env != nil {
+		return n.env(key)
+	}
+
+	return os.Getenv(key)
+}
+
+// disabled reports whether n is nil or Disabled, and should not send any
+// notifications.
+func (n *Notifier) disabled() bool {
+	switch {
+	case n == nil:
+		return true
+	case n.parent != nil:
+		return n.parent.disabled()
+	default:
+		n.connMu.RLock()
+		defer n.connMu.RUnlock()
+
+		return n.wc == nil && n.multi == nil
+	}
 }
@@ -0,0 +1,1250 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+	"golang.org/x/sys/unix"
+)
+
+func TestNotifierNotExist(t *testing.T) {
+	testIsNotExist(t, "open", func(t *testing.T) (*sdnotify.Notifier, error) {
+		// This path is very likely to not exist.
+		return sdnotify.Open("/not/exist")
+	})
+
+	testIsNotExist(t, "new", func(t *testing.T) (*sdnotify.Notifier, error) {
+		// This subtest needs an unset notify socket.
+		if s := os.Getenv(sdnotify.Socket); s != "" {
+			t.Skipf("skipping, notify socket set to %q", s)
+		}
+
+		return sdnotify.New()
+	})
+}
+
+func TestNewMalformedSocket(t *testing.T) {
+	t.Run("relative", func(t *testing.T) {
+		t.Setenv(sdnotify.Socket, "notify.sock")
+
+		_, err := sdnotify.New()
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected malformed socket error, but got: %v", err)
+		}
+		if !strings.Contains(err.Error(), `"notify.sock"`) {
+			t.Fatalf("expected error to contain socket path, but got: %v", err)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		t.Setenv(sdnotify.Socket, "")
+
+		_, err := sdnotify.New()
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected not exist, but got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "set but empty") {
+			t.Fatalf("expected set but empty error, but got: %v", err)
+		}
+	})
+
+	t.Run("abstract", func(t *testing.T) {
+		pc, err := net.ListenPacket("unixgram", "")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		defer pc.Close()
+
+		t.Setenv(sdnotify.Socket, pc.LocalAddr().String())
+
+		n, err := sdnotify.New()
+		if err != nil {
+			t.Fatalf("failed to create notifier: %v", err)
+		}
+		_ = n.Close()
+	})
+}
+
+func testIsNotExist(t *testing.T, name string, fn func(t *testing.T) (*sdnotify.Notifier, error)) {
+	t.Run(name, func(t *testing.T) {
+		n, err := fn(t)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected is not exist, but got: %v", err)
+		}
+
+		// None of these operations should error or panic even though the Notifier
+		// is nil.
+		if n.Enabled() {
+			t.Fatal("expected disabled Notifier")
+		}
+		if addr := n.LocalAddr(); addr != nil {
+			t.Fatalf("expected nil local address, but got: %v", addr)
+		}
+		if addr := n.RemoteAddr(); addr != nil {
+			t.Fatalf("expected nil remote address, but got: %v", addr)
+		}
+		if err := n.Notify("noop"); err != nil {
+			t.Fatalf("failed to noop notify: %v", err)
+		}
+		if err := n.Close(); err != nil {
+			t.Fatalf("failed to noop close: %v", err)
+		}
+	})
+}
+
+func TestInterface(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	for _, i := range []sdnotify.Interface{sdnotify.Nop{}, n} {
+		if err := i.Notify(sdnotify.Ready); err != nil {
+			t.Fatalf("failed to notify: %v", err)
+		}
+	}
+
+	// Only the Notifier produces output.
+	if diff := cmp.Diff(sdnotify.Ready, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifierEcho(t *testing.T) {
+	tests := []struct {
+		name string
+		ss   []string
+	}{
+		{
+			name: "ready",
+			ss:   []string{sdnotify.Ready},
+		},
+		{
+			name: "reloading",
+			ss: []string{
+				sdnotify.MonotonicUsec(time.Now()),
+				sdnotify.Reloading,
+			},
+		},
+		{
+			name: "watchdog",
+			ss:   []string{sdnotify.Watchdog},
+		},
+		{
+			name: "watchdog trigger",
+			ss:   []string{sdnotify.WatchdogTrigger},
+		},
+		{
+			name: "errno stopping",
+			ss: []string{
+				sdnotify.Errno(int(unix.ENOSPC)),
+				sdnotify.Stopping,
+			},
+		},
+		{
+			name: "main PID",
+			ss:   []string{sdnotify.MainPID(os.Getpid())},
+		},
+		{
+			name: "status stopping",
+			ss: []string{
+				sdnotify.Statusf("stopping in %s", 5*time.Second),
+				sdnotify.Stopping,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Open a local listener which will receive messages from the
+			// Notifier.
+			pc, err := net.ListenPacket("unixgram", "")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer pc.Close()
+
+			if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				t.Fatalf("failed to set deadline: %v", err)
+			}
+
+			// Echo back any received messages.
+			strC := make(chan string)
+			go func() {
+				b := make([]byte, 128)
+				n, _, err := pc.ReadFrom(b)
+				if err != nil {
+					panicf("failed to read: %v", err)
+				}
+
+				strC <- string(b[:n])
+			}()
+
+			// Send a notification to the client and expect the same back after
+			// splitting on newlines added automatically by Notify.
+			n, err := sdnotify.Open(pc.LocalAddr().String())
+			if err != nil {
+				t.Fatalf("failed to open: %v", err)
+			}
+			defer n.Close()
+
+			if diff := cmp.Diff(pc.LocalAddr().String(), n.RemoteAddr().String()); diff != "" {
+				t.Fatalf("unexpected remote address (-want +got):\n%s", diff)
+			}
+			if n.LocalAddr() == nil {
+				t.Fatal("expected non-nil local address")
+			}
+			if !n.Enabled() {
+				t.Fatal("expected enabled Notifier")
+			}
+
+			if err := n.Notify(tt.ss...); err != nil {
+				t.Fatalf("failed to notify: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.ss, strings.Split(<-strC, "\n")); diff != "" {
+				t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNotifierReadyStop(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(n *sdnotify.Notifier) error
+		ss   []string
+	}{
+		{
+			name: "ready",
+			fn:   func(n *sdnotify.Notifier) error { return n.Ready("") },
+			ss:   []string{sdnotify.Ready},
+		},
+		{
+			name: "ready status",
+			fn:   func(n *sdnotify.Notifier) error { return n.Ready("started") },
+			ss:   []string{"STATUS=started", sdnotify.Ready},
+		},
+		{
+			name: "stop",
+			fn:   func(n *sdnotify.Notifier) error { return n.Stop("") },
+			ss:   []string{sdnotify.Stopping},
+		},
+		{
+			name: "stop status",
+			fn:   func(n *sdnotify.Notifier) error { return n.Stop("shutting down") },
+			ss:   []string{"STATUS=shutting down", sdnotify.Stopping},
+		},
+		{
+			name: "fail",
+			fn: func(n *sdnotify.Notifier) error {
+				return n.Failf(int(unix.EADDRINUSE), "failed to listen on port %d", 80)
+			},
+			ss: []string{
+				"STATUS=failed to listen on port 80",
+				sdnotify.Errno(int(unix.EADDRINUSE)),
+				sdnotify.Stopping,
+			},
+		},
+		{
+			name: "progress",
+			fn:   func(n *sdnotify.Notifier) error { return n.Progress(4, 10, "loaded shards") },
+			ss:   []string{"STATUS=loaded shards (4/10)"},
+		},
+		{
+			name: "progress no message",
+			fn:   func(n *sdnotify.Notifier) error { return n.Progress(4, 10, "") },
+			ss:   []string{"STATUS=4/10"},
+		},
+		{
+			name: "progress unknown total",
+			fn:   func(n *sdnotify.Notifier) error { return n.Progress(4, 0, "loading shards") },
+			ss:   []string{"STATUS=loading shards"},
+		},
+		{
+			name: "progress sanitized",
+			fn:   func(n *sdnotify.Notifier) error { return n.Progress(1, 2, "loaded\nshards") },
+			ss:   []string{"STATUS=loaded shards (1/2)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, pc := testNotifier(t)
+
+			if err := tt.fn(n); err != nil {
+				t.Fatalf("failed to notify: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.ss, strings.Split(readString(t, pc), "\n")); diff != "" {
+				t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNotifierReadyOnce(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	const workers = 16
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	errC := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			errC <- n.ReadyOnce()
+		}()
+	}
+
+	wg.Wait()
+	close(errC)
+	for err := range errC {
+		if err != nil {
+			t.Fatalf("failed to notify: %v", err)
+		}
+	}
+
+	// Send a sentinel notification so that any duplicate Ready would be read
+	// before it.
+	if err := n.Notify(sdnotify.Watchdog); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	got := []string{readString(t, pc), readString(t, pc)}
+	if diff := cmp.Diff([]string{sdnotify.Ready, sdnotify.Watchdog}, got); diff != "" {
+		t.Fatalf("unexpected notifications (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifierConcurrent(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	const workers, messages = 8, 32
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	// If the test fails early, closing the listener unblocks any writers
+	// waiting on a full socket queue so they can exit.
+	t.Cleanup(func() {
+		_ = pc.Close()
+		wg.Wait()
+	})
+
+	errC := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < messages; j++ {
+				err := n.Notify(
+					sdnotify.Statusf("worker %d message %d", i, j),
+					sdnotify.Watchdog,
+				)
+				if err != nil {
+					errC <- err
+					return
+				}
+			}
+		}(i)
+	}
+
+	// Every datagram must contain exactly the notifications from one call.
+	for i := 0; i < workers*messages; i++ {
+		ss := strings.Split(readString(t, pc), "\n")
+		if len(ss) != 2 || !strings.HasPrefix(ss[0], "STATUS=worker ") || ss[1] != sdnotify.Watchdog {
+			t.Fatalf("unexpected notification: %q", ss)
+		}
+	}
+
+	wg.Wait()
+	close(errC)
+	for err := range errC {
+		t.Fatalf("failed to notify: %v", err)
+	}
+}
+
+func TestNotifierNotifyContext(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := n.NotifyContext(ctx, sdnotify.Ready); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, but got: %v", err)
+	}
+
+	// The listener never reads, so eventually the socket buffer will fill and
+	// writes will block until the context deadline is exceeded.
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	for {
+		err := n.NotifyContext(ctx, sdnotify.Statusf("%s", strings.Repeat("a", 1024)))
+		if err == nil {
+			continue
+		}
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, but got: %v", err)
+		}
+
+		break
+	}
+
+	// Once the listener reads a message, notifications must succeed again
+	// since NotifyContext clears the write deadline.
+	_ = readString(t, pc)
+	if err := n.Notify(sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+}
+
+func TestNotifierNotifyInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+	}{
+		{name: "empty"},
+		{name: "no separator", s: "READY"},
+		{name: "empty key", s: "=1"},
+		{name: "lowercase key", s: "ready=1"},
+		{name: "leading digit", s: "1READY=1"},
+		{name: "newline", s: "STATUS=foo\nREADY=1"},
+		{name: "NUL", s: "STATUS=foo\x00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, _ := testNotifier(t)
+
+			err := n.Notify(sdnotify.Ready, tt.s)
+			if err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !strings.Contains(err.Error(), "notification 1") {
+				t.Fatalf("expected error to identify notification, but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestNotifierNotifyRaw(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	const raw = "not a valid notification"
+	if err := n.NotifyRaw(raw); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	if diff := cmp.Diff(raw, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifierNotifyTooLarge(t *testing.T) {
+	n, _ := testNotifier(t)
+
+	// Larger than Linux's default maximum socket send buffer size.
+	err := n.Notify(sdnotify.Statusf("%s", strings.Repeat("a", 1<<20)))
+	if !errors.Is(err, unix.EMSGSIZE) {
+		t.Fatalf("expected EMSGSIZE, but got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "1048583 byte notification") {
+		t.Fatalf("expected descriptive error, but got: %v", err)
+	}
+}
+
+func TestNotifierNotifySplit(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	// Size a so that it and MONOTONIC_USEC exactly fill a datagram, which
+	// must not separate MONOTONIC_USEC from RELOADING.
+	var (
+		mono = sdnotify.Monotonic()
+		a    = sdnotify.Statusf("%s", strings.Repeat("a", 4096-len("STATUS=")-len(mono)-1))
+		b    = sdnotify.Statusf("%s", strings.Repeat("b", 3000))
+	)
+
+	if err := n.Notify(a, mono, sdnotify.Reloading, b); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	want := [][]string{
+		{a},
+		{mono, sdnotify.Reloading, b},
+	}
+
+	buf := make([]byte, 8192)
+	for _, w := range want {
+		nb, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+
+		if diff := cmp.Diff(w, strings.Split(string(buf[:nb]), "\n")); diff != "" {
+			t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestNotifierNotifyLargeStatus(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	// The result must not depend on the socket's send buffer size.
+	for i := 0; i < 3; i++ {
+		err := n.Notify(sdnotify.Statusf("%s", strings.Repeat("a", 200*1024)))
+		if !errors.Is(err, unix.EMSGSIZE) {
+			t.Fatalf("expected EMSGSIZE, but got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "maximum size of 4096 bytes") {
+			t.Fatalf("expected descriptive error, but got: %v", err)
+		}
+	}
+
+	// The largest permitted notification is sent intact.
+	s := sdnotify.Statusf("%s", strings.Repeat("a", 4096-len("STATUS=")))
+	if err := n.Notify(s); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	b := make([]byte, 8192)
+	nb, _, err := pc.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if diff := cmp.Diff(s, string(b[:nb])); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestErrnoErr(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		s    string
+		ok   bool
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name: "not errno",
+			err:  errors.New("foo"),
+		},
+		{
+			name: "errno",
+			err:  unix.ENOSPC,
+			s:    sdnotify.Errno(int(unix.ENOSPC)),
+			ok:   true,
+		},
+		{
+			name: "wrapped errno",
+			err:  fmt.Errorf("failed to write: %w", os.NewSyscallError("write", unix.EIO)),
+			s:    "ERRNO=5",
+			ok:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok := sdnotify.ErrnoErr(tt.err)
+			if tt.s != s || tt.ok != ok {
+				t.Fatalf("unexpected errno: want (%q, %t), got (%q, %t)", tt.s, tt.ok, s, ok)
+			}
+		})
+	}
+}
+
+func TestMonotonicUsec(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset time.Duration
+		fn     func() string
+	}{
+		{
+			name: "now",
+			fn:   sdnotify.Monotonic,
+		},
+		{
+			// Generate a timestamp one second in the past.
+			name:   "past",
+			offset: 1 * time.Second,
+			fn: func() string {
+				return sdnotify.MonotonicUsec(time.Now().Add(-1 * time.Second))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testMonotonicUsec(t, tt.offset, tt.fn)
+		})
+	}
+}
+
+// testMonotonicUsec verifies that the MONOTONIC_USEC notification produced by
+// fn lands within a reasonable window of the CLOCK_MONOTONIC value minus
+// offset.
+func testMonotonicUsec(t *testing.T, offset time.Duration, fn func() string) {
+	t.Helper()
+
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		t.Fatalf("failed to read monotonic clock: %v", err)
+	}
+
+	s := fn()
+
+	const prefix = "MONOTONIC_USEC="
+	if !strings.HasPrefix(s, prefix) {
+		t.Fatalf("unexpected notification: %q", s)
+	}
+
+	usec, err := strconv.ParseInt(strings.TrimPrefix(s, prefix), 10, 64)
+	if err != nil {
+		t.Fatalf("failed to parse microseconds: %v", err)
+	}
+
+	var (
+		want = (time.Duration(ts.Nano()) - offset).Truncate(time.Microsecond)
+		got  = time.Duration(usec) * time.Microsecond
+	)
+
+	if d := got - want; d < -1*time.Second || d > 1*time.Second {
+		t.Fatalf("unexpected monotonic timestamp: want ~%s, got %s", want, got)
+	}
+}
+
+func TestNotifierAbstract(t *testing.T) {
+	sock := fmt.Sprintf("@sdnotify-test-%d", os.Getpid())
+
+	pc, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	// Verify that the abstract socket name from NOTIFY_SOCKET is used as-is.
+	t.Setenv(sdnotify.Socket, sock)
+
+	n, err := sdnotify.New()
+	if err != nil {
+		t.Fatalf("failed to create notifier: %v", err)
+	}
+	defer n.Close()
+
+	if err := n.Notify(sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	if diff := cmp.Diff(sdnotify.Ready, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestOpenPID(t *testing.T) {
+	pc, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	// Like systemd, the listener must enable SO_PASSCRED to receive
+	// credentials.
+	rc, err := pc.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to get raw conn: %v", err)
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PASSCRED, 1)
+	}); err != nil || serr != nil {
+		t.Fatalf("failed to set SO_PASSCRED: %v, %v", err, serr)
+	}
+
+	// Sending credentials for the current process requires no privileges.
+	n, err := sdnotify.OpenPID(pc.LocalAddr().String(), os.Getpid())
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer n.Close()
+
+	// The sending socket must also have SO_PASSCRED enabled.
+	fd, err := n.DupFD()
+	if err != nil {
+		t.Fatalf("failed to duplicate socket: %v", err)
+	}
+	defer unix.Close(fd)
+
+	passcred, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_PASSCRED)
+	if err != nil {
+		t.Fatalf("failed to get SO_PASSCRED: %v", err)
+	}
+	if passcred != 1 {
+		t.Fatal("expected SO_PASSCRED on sending socket")
+	}
+
+	if err := n.Notify(sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	b := make([]byte, 128)
+	oob := make([]byte, unix.CmsgSpace(unix.SizeofUcred))
+	nb, oobn, _, _, err := pc.ReadMsgUnix(b, oob)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff(sdnotify.Ready, string(b[:nb])); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	scms, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(scms) != 1 {
+		t.Fatalf("failed to parse control messages: %v", err)
+	}
+
+	creds, err := unix.ParseUnixCredentials(&scms[0])
+	if err != nil {
+		t.Fatalf("failed to parse credentials: %v", err)
+	}
+
+	want := &unix.Ucred{
+		Pid: int32(os.Getpid()),
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+
+	if diff := cmp.Diff(want, creds); diff != "" {
+		t.Fatalf("unexpected credentials (-want +got):\n%s", diff)
+	}
+}
+
+func TestOpenTypeStream(t *testing.T) {
+	l, err := net.Listen("unix", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	n, err := sdnotify.OpenType(l.Addr().String(), "unix")
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer n.Close()
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer c.Close()
+
+	if err := n.Notify(sdnotify.Statusf("starting")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := n.Notify(sdnotify.Statusf("started"), sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	_ = n.Close()
+
+	b, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	const want = "STATUS=starting\nSTATUS=started\nREADY=1\n"
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Fatalf("unexpected notifications (-want +got):\n%s", diff)
+	}
+}
+
+func TestOpenDetectStream(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "notify.sock")
+
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	n, err := sdnotify.Open(sock)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer n.Close()
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer c.Close()
+
+	if err := n.Notify(sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	_ = n.Close()
+
+	b, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	// The stream framing shows that the stream socket was detected.
+	if diff := cmp.Diff("READY=1\n", string(b)); diff != "" {
+		t.Fatalf("unexpected notifications (-want +got):\n%s", diff)
+	}
+}
+
+func TestOpenContext(t *testing.T) {
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	n, err := sdnotify.OpenContext(context.Background(), pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	_ = n.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := sdnotify.OpenContext(ctx, pc.LocalAddr().String()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, but got: %v", err)
+	}
+}
+
+func TestOpenTypeStreamRights(t *testing.T) {
+	l, err := net.Listen("unix", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	n, err := sdnotify.OpenType(l.Addr().String(), "unix")
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer n.Close()
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer c.Close()
+
+	uc := c.(*net.UnixConn)
+	if err := uc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	// Messages carrying file descriptors must be framed like any other.
+	errC := make(chan error, 1)
+	go func() {
+		errC <- n.Barrier(context.Background())
+	}()
+
+	s, fds := readRights(t, uc)
+	if diff := cmp.Diff("BARRIER=1\n", s); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+	for _, fd := range fds {
+		_ = unix.Close(fd)
+	}
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to wait for barrier: %v", err)
+	}
+
+	if err := n.Store(os.Stdin); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	s, fds = readRights(t, uc)
+	if diff := cmp.Diff("FDSTORE=1\n", s); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+	for _, fd := range fds {
+		_ = unix.Close(fd)
+	}
+
+	if err := n.Notify(sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	if diff := cmp.Diff("READY=1\n", readString(t, uc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifierIntegration(t *testing.T) {
+	// Use a test binary in a fixed position and skip if unavailable.
+	const bin = "./sdnotifytest"
+	if _, err := os.Stat(bin); err != nil {
+		t.Skipf("skipping, cannot stat: %v", err)
+	}
+
+	// Find a file suitable for listening on a socket and clean it up
+	// immediately and after test execution.
+	f, err := ioutil.TempFile("", "sdnotifytest")
+	if err != nil {
+		t.Fatalf("failed to create temporary file: %v", err)
+	}
+	_ = f.Close()
+
+	remove := func() {
+		if err := os.RemoveAll(f.Name()); err != nil {
+			t.Fatalf("failed to remove temporary file: %v", err)
+		}
+	}
+	remove()
+	defer remove()
+
+	pc, err := net.ListenPacket("unixgram", f.Name())
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	// Collect each received datagram and send them back to the main
+	// goroutine once the command's final notification arrives.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	defer func() {
+		// Unblock the reader if the command failed to finish.
+		_ = pc.Close()
+		wg.Wait()
+	}()
+
+	notifC := make(chan []string, 1)
+	go func() {
+		defer wg.Done()
+
+		var ss []string
+		b := make([]byte, 128)
+		for {
+			n, _, err := pc.ReadFrom(b)
+			if err != nil {
+				if strings.Contains(err.Error(), "use of closed") {
+					break
+				}
+
+				panicf("failed to read: %v", err)
+			}
+
+			ss = append(ss, string(b[:n]))
+			if strings.HasSuffix(ss[len(ss)-1], sdnotify.Stopping) {
+				break
+			}
+		}
+
+		notifC <- ss
+	}()
+
+	// Now that we've created a unixgram listener, invoke the test command with
+	// NOTIFY_SOCKET set in its environment.
+	cmd := exec.Command(bin)
+	cmd.Env = []string{sdnotify.Socket + "=" + f.Name()}
+	b, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to run command: %v\nout:\n%s", err, string(b))
+	}
+
+	// The command mirrors each batch to stdout with a trailing newline.
+	const stdout = `STATUS=waiting 0
+STATUS=waiting 1
+STATUS=waiting 2
+READY=1
+STATUS=done
+STOPPING=1
+`
+
+	if diff := cmp.Diff(stdout, string(b)); diff != "" {
+		t.Fatalf("unexpected stdout (-want +got):\n%s", diff)
+	}
+
+	// Each call to Notify sends one datagram, within which the notifications
+	// are newline delimited.
+	want := []string{
+		"STATUS=waiting 0",
+		"STATUS=waiting 1",
+		"STATUS=waiting 2",
+		"READY=1\nSTATUS=done\nSTOPPING=1",
+	}
+
+	if diff := cmp.Diff(want, <-notifC); diff != "" {
+		t.Fatalf("unexpected notifications (-want +got):\n%s", diff)
+	}
+}
+
+// testNotifier creates a Notifier which sends notifications to a local
+// listener, which is also returned.
+func TestNotifierNotifyAllocs(t *testing.T) {
+	n, pc := testNotifier(t)
+	go discard(pc)
+
+	// Frequent notifications such as Watchdog must not allocate.
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := n.Notify(sdnotify.Watchdog); err != nil {
+			panicf("failed to notify: %v", err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, but got %v", allocs)
+	}
+}
+
+func BenchmarkNotifierNotify(b *testing.B) {
+	tests := []struct {
+		name string
+		s    []string
+	}{
+		{name: "ready", s: []string{sdnotify.Ready}},
+		{name: "status ready", s: []string{"STATUS=started", sdnotify.MainPID(1), sdnotify.Ready}},
+	}
+
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			n, pc := benchNotifier(b)
+			go discard(pc)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if err := n.Notify(tt.s...); err != nil {
+					b.Fatalf("failed to notify: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func benchNotifier(b *testing.B) (*sdnotify.Notifier, net.PacketConn) {
+	b.Helper()
+
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		b.Fatalf("failed to listen: %v", err)
+	}
+	b.Cleanup(func() { _ = pc.Close() })
+
+	n, err := sdnotify.Open(pc.LocalAddr().String())
+	if err != nil {
+		b.Fatalf("failed to open: %v", err)
+	}
+	b.Cleanup(func() { _ = n.Close() })
+
+	return n, pc
+}
+
+// discard reads and discards datagrams from pc until it is closed.
+func discard(pc net.PacketConn) {
+	buf := make([]byte, 4096)
+	for {
+		if _, _, err := pc.ReadFrom(buf); err != nil {
+			return
+		}
+	}
+}
+
+func testNotifier(t *testing.T) (*sdnotify.Notifier, net.PacketConn) {
+	t.Helper()
+
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	n, err := sdnotify.Open(pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	t.Cleanup(func() { _ = n.Close() })
+
+	return n, pc
+}
+
+// readString reads a single datagram from pc.
+func readString(t *testing.T, pc net.PacketConn) string {
+	t.Helper()
+
+	b := make([]byte, 128)
+	n, _, err := pc.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	return string(b[:n])
+}
+
+func panicf(format string, a ...interface{}) {
+	panic(fmt.Sprintf(format, a...))
+}
+
+func TestNotifierSocketGone(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	// Closing the listener simulates systemd going away mid-run.
+	if err := pc.Close(); err != nil {
+		t.Fatalf("failed to close listener: %v", err)
+	}
+
+	err := n.Notify(sdnotify.Watchdog)
+	if !sdnotify.IsSocketUnavailable(err) {
+		t.Fatalf("expected socket unavailable, but got: %v", err)
+	}
+	if !errors.Is(err, unix.ECONNREFUSED) {
+		t.Fatalf("expected ECONNREFUSED, but got: %v", err)
+	}
+
+	if sdnotify.IsSocketUnavailable(errors.New("foo")) {
+		t.Fatal("expected arbitrary error to be available")
+	}
+}
+
+func TestOpenConnFD(t *testing.T) {
+	tests := []struct {
+		name string
+		open func(t *testing.T, c *net.UnixConn) *sdnotify.Notifier
+	}{
+		{
+			name: "conn",
+			open: func(_ *testing.T, c *net.UnixConn) *sdnotify.Notifier {
+				return sdnotify.OpenConn(c)
+			},
+		},
+		{
+			name: "fd",
+			open: func(t *testing.T, c *net.UnixConn) *sdnotify.Notifier {
+				f, err := c.File()
+				if err != nil {
+					t.Fatalf("failed to get file: %v", err)
+				}
+				defer f.Close()
+				defer c.Close()
+
+				n, err := sdnotify.OpenFD(int(f.Fd()))
+				if err != nil {
+					t.Fatalf("failed to open descriptor: %v", err)
+				}
+
+				return n
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sock := filepath.Join(t.TempDir(), "notify.sock")
+
+			pc, err := net.ListenPacket("unixgram", sock)
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer pc.Close()
+
+			if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				t.Fatalf("failed to set deadline: %v", err)
+			}
+
+			c, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: sock, Net: "unixgram"})
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+
+			n := tt.open(t, c)
+			if err := n.Notify(sdnotify.Statusf("started"), sdnotify.Ready); err != nil {
+				t.Fatalf("failed to notify: %v", err)
+			}
+
+			// Datagrams are sent without stream framing.
+			if diff := cmp.Diff("STATUS=started\nREADY=1", readString(t, pc)); diff != "" {
+				t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+			}
+
+			if err := n.Close(); err != nil {
+				t.Fatalf("failed to close: %v", err)
+			}
+			if _, err := os.Stat(sock); err != nil {
+				t.Fatalf("expected socket to remain after close: %v", err)
+			}
+		})
+	}
+}
+
+func TestNotifierDupFD(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	fd, err := n.DupFD()
+	if err != nil {
+		t.Fatalf("failed to duplicate: %v", err)
+	}
+	defer unix.Close(fd)
+
+	flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0)
+	if err != nil {
+		t.Fatalf("failed to get descriptor flags: %v", err)
+	}
+	if flags&unix.FD_CLOEXEC != 0 {
+		t.Fatal("expected descriptor without close-on-exec")
+	}
+
+	// Reconstruct the Notifier as a re-executed process would.
+	dn, err := sdnotify.OpenFD(fd)
+	if err != nil {
+		t.Fatalf("failed to open descriptor: %v", err)
+	}
+	defer dn.Close()
+
+	if err := dn.Notify(sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if diff := cmp.Diff(sdnotify.Ready, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	if _, err := sdnotify.OpenWriter(io.Discard).DupFD(); err == nil {
+		t.Fatal("expected error duplicating writer")
+	}
+
+	var nn *sdnotify.Notifier
+	if _, err := nn.DupFD(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist, but got: %v", err)
+	}
+}
@@ -2,15 +2,12 @@ package sdnotify_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net"
 	"os"
-	"os/exec"
 	"strings"
-	"sync"
 	"testing"
 	"time"
 
@@ -18,183 +15,518 @@ import (
 	"github.com/mdlayher/sdnotify"
 )
 
-func TestNotifierNotExist(t *testing.T) {
-	testIsNotExist(t, "open", func(t *testing.T) (*sdnotify.Notifier, error) {
-		// This path is very likely to not exist.
-		return sdnotify.Open("/not/exist")
-	})
+func TestParseSocket(t *testing.T) {
+	tests := []struct {
+		name          string
+		s             string
+		network, addr string
+		ok            bool
+	}{
+		{name: "path", s: "/run/systemd/notify", network: "unixgram", addr: "/run/systemd/notify", ok: true},
+		{name: "abstract", s: "@notify", network: "unixgram", addr: "@notify", ok: true},
+		{name: "whitespace", s: " /run/systemd/notify\n", network: "unixgram", addr: "/run/systemd/notify", ok: true},
+		{name: "vsock", s: "vsock:2:1234", network: "vsock", addr: "2:1234", ok: true},
+		{name: "empty"},
+		{name: "empty abstract", s: "@"},
+		{name: "relative", s: "notify.sock"},
+		{name: "bad vsock", s: "vsock:host"},
+		{name: "other", s: "tcp:127.0.0.1:80"},
+	}
 
-	testIsNotExist(t, "new", func(t *testing.T) (*sdnotify.Notifier, error) {
-		// This subtest needs an unset notify socket.
-		if s := os.Getenv(sdnotify.Socket); s != "" {
-			t.Skipf("skipping, notify socket set to %q", s)
-		}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network, addr, err := sdnotify.ParseSocket(tt.s)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				return
+			}
 
-		return sdnotify.New()
-	})
+			if diff := cmp.Diff([]string{tt.network, tt.addr}, []string{network, addr}); diff != "" {
+				t.Fatalf("unexpected socket (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, _, err := sdnotify.ParseSocket(""); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist, but got: %v", err)
+	}
+	if _, err := sdnotify.Open("vsock:2:1234"); err == nil {
+		t.Fatal("expected an error opening a vsock socket")
+	}
 }
 
-func testIsNotExist(t *testing.T, name string, fn func(t *testing.T) (*sdnotify.Notifier, error)) {
-	t.Run(name, func(t *testing.T) {
-		n, err := fn(t)
-		if !errors.Is(err, os.ErrNotExist) {
-			t.Fatalf("expected is not exist, but got: %v", err)
-		}
+func TestDisabled(t *testing.T) {
+	n := sdnotify.Disabled()
+	if n == nil {
+		t.Fatal("expected non-nil Notifier")
+	}
 
-		// None of these operations should error or panic even though the Notifier
-		// is nil.
-		if err := n.Notify("noop"); err != nil {
-			t.Fatalf("failed to noop notify: %v", err)
-		}
-		if err := n.Close(); err != nil {
-			t.Fatalf("failed to noop close: %v", err)
-		}
-	})
+	// None of these operations should error or panic.
+	if n.Enabled() {
+		t.Fatal("expected disabled Notifier")
+	}
+	if addr := n.RemoteAddr(); addr != nil {
+		t.Fatalf("expected nil remote address, but got: %v", addr)
+	}
+	if err := n.Notify("noop"); err != nil {
+		t.Fatalf("failed to noop notify: %v", err)
+	}
+	if err := n.Close(); err != nil {
+		t.Fatalf("failed to noop close: %v", err)
+	}
 }
 
-func TestNotifierEcho(t *testing.T) {
+func TestDisabledMethods(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ctx := context.Background()
+
+	// Every exported method must be a safe no-op on a nil or Disabled
+	// Notifier. Methods which cannot meaningfully succeed report
+	// os.ErrNotExist instead.
 	tests := []struct {
-		name string
-		ss   []string
+		name     string
+		fn       func(n *sdnotify.Notifier) error
+		notExist bool
 	}{
+		{name: "Barrier", fn: func(n *sdnotify.Notifier) error { return n.Barrier(ctx) }},
+		{name: "Close", fn: (*sdnotify.Notifier).Close},
 		{
-			name: "ready",
-			ss:   []string{sdnotify.Ready},
+			name:     "DupFD",
+			fn:       func(n *sdnotify.Notifier) error { _, err := n.DupFD(); return err },
+			notExist: true,
+		},
+		{
+			name: "Enabled",
+			fn: func(n *sdnotify.Notifier) error {
+				if n.Enabled() {
+					return errors.New("enabled")
+				}
+				return nil
+			},
+		},
+		{name: "Err", fn: (*sdnotify.Notifier).Err},
+		{
+			name: "Errors",
+			fn: func(n *sdnotify.Notifier) error {
+				if _, ok := <-n.Errors(); ok {
+					return errors.New("open errors channel")
+				}
+				return nil
+			},
 		},
+		{name: "Failf", fn: func(n *sdnotify.Notifier) error { return n.Failf(1, "failed") }},
+		{name: "Flush", fn: (*sdnotify.Notifier).Flush},
 		{
-			name: "status stopping",
-			ss: []string{
-				sdnotify.Statusf("stopping in %s", 5*time.Second),
-				sdnotify.Stopping,
+			name: "KeepAlive",
+			fn: func(n *sdnotify.Notifier) error {
+				errC, err := n.KeepAlive(ctx, time.Second)
+				if err != nil {
+					return err
+				}
+				if _, ok := <-errC; ok {
+					return errors.New("open channel")
+				}
+				return nil
+			},
+		},
+		{
+			name: "LastNotify",
+			fn: func(n *sdnotify.Notifier) error {
+				if ss, at := n.LastNotify(); ss != nil || !at.IsZero() {
+					return errors.New("unexpected notifications")
+				}
+				return nil
 			},
 		},
+		{
+			name: "LocalAddr",
+			fn: func(n *sdnotify.Notifier) error {
+				if n.LocalAddr() != nil {
+					return errors.New("non-nil address")
+				}
+				return nil
+			},
+		},
+		{name: "Notify", fn: func(n *sdnotify.Notifier) error { return n.Notify(sdnotify.Ready) }},
+		{
+			name: "NotifyContext",
+			fn:   func(n *sdnotify.Notifier) error { return n.NotifyContext(ctx, sdnotify.Ready) },
+		},
+		{
+			name: "NotifyMap",
+			fn:   func(n *sdnotify.Notifier) error { return n.NotifyMap(map[string]string{"READY": "1"}) },
+		},
+		{
+			name: "NotifyMarshal",
+			fn:   func(n *sdnotify.Notifier) error { return n.NotifyMarshal(sdnotify.Notification(sdnotify.Ready)) },
+		},
+		{name: "NotifyRaw", fn: func(n *sdnotify.Notifier) error { return n.NotifyRaw("noop") }},
+		{
+			name: "NotifyState",
+			fn:   func(n *sdnotify.Notifier) error { return n.NotifyState(sdnotify.State{Ready: true}) },
+		},
+		{name: "NotifyTyped", fn: func(n *sdnotify.Notifier) error { return n.NotifyTyped(sdnotify.Ready) }},
+		{
+			name: "OnReload",
+			fn: func(n *sdnotify.Notifier) error {
+				if err := n.OnReload(canceled, func() error { return nil }); !errors.Is(err, context.Canceled) {
+					return fmt.Errorf("unexpected error: %v", err)
+				}
+				return nil
+			},
+		},
+		{name: "Progress", fn: func(n *sdnotify.Notifier) error { return n.Progress(1, 2, "loading") }},
+		{name: "Ready", fn: func(n *sdnotify.Notifier) error { return n.Ready("ready") }},
+		{name: "ReadyOnce", fn: (*sdnotify.Notifier).ReadyOnce},
+		{name: "ReadyAndWait", fn: func(n *sdnotify.Notifier) error { return n.ReadyAndWait(ctx) }},
+		{
+			name: "Reload",
+			fn:   func(n *sdnotify.Notifier) error { return n.Reload(ctx, func() error { return nil }) },
+		},
+		{
+			name: "RemoteAddr",
+			fn: func(n *sdnotify.Notifier) error {
+				if n.RemoteAddr() != nil {
+					return errors.New("non-nil address")
+				}
+				return nil
+			},
+		},
+		{
+			name:     "RemoveStored",
+			fn:       func(n *sdnotify.Notifier) error { return n.RemoveStored("http") },
+			notExist: true,
+		},
+		{name: "Reset", fn: (*sdnotify.Notifier).Reset},
+		{
+			name: "Run",
+			fn: func(n *sdnotify.Notifier) error {
+				return n.Run(ctx, func(_ context.Context, ready func() error) error { return ready() })
+			},
+		},
+		{
+			name: "Scoped",
+			fn: func(n *sdnotify.Notifier) error {
+				if n.Scoped("foo: ").Enabled() {
+					return errors.New("enabled")
+				}
+				return nil
+			},
+		},
+		{
+			name: "Sent",
+			fn: func(n *sdnotify.Notifier) error {
+				if n.Sent() != nil {
+					return errors.New("unexpected notifications")
+				}
+				return nil
+			},
+		},
+		{
+			name: "StartWatchdog",
+			fn: func(n *sdnotify.Notifier) error {
+				errC, err := n.StartWatchdog(ctx)
+				if err != nil {
+					return err
+				}
+				if _, ok := <-errC; ok {
+					return errors.New("open channel")
+				}
+				return nil
+			},
+		},
+		{
+			name: "StartupContext",
+			fn: func(n *sdnotify.Notifier) error {
+				if n.StartupContext(ctx) != ctx {
+					return errors.New("derived context")
+				}
+				return nil
+			},
+		},
+		{name: "Stop", fn: func(n *sdnotify.Notifier) error { return n.Stop("stopping") }},
+		{
+			name:     "Store",
+			fn:       func(n *sdnotify.Notifier) error { return n.Store(os.Stdin) },
+			notExist: true,
+		},
+		{
+			name:     "StoreNamed",
+			fn:       func(n *sdnotify.Notifier) error { return n.StoreNamed("stdin", os.Stdin) },
+			notExist: true,
+		},
+		{
+			name: "Supports",
+			fn: func(n *sdnotify.Notifier) error {
+				if n.Supports() != (sdnotify.Features{}) {
+					return errors.New("unexpected features")
+				}
+				return nil
+			},
+		},
+		{name: "TriggerRestart", fn: (*sdnotify.Notifier).TriggerRestart},
+		{name: "WaitSocketReady", fn: func(n *sdnotify.Notifier) error { return n.WaitSocketReady(ctx) }},
+		{
+			name: "WatchdogLoop",
+			fn:   func(n *sdnotify.Notifier) error { return n.WatchdogLoop(ctx, func() error { return nil }) },
+		},
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Open a local listener which will receive messages from the
-			// Notifier.
-			pc, err := net.ListenPacket("unixgram", "")
-			if err != nil {
-				t.Fatalf("failed to listen: %v", err)
-			}
-			defer pc.Close()
+	notifiers := []struct {
+		name string
+		n    *sdnotify.Notifier
+	}{
+		{name: "nil"},
+		{name: "disabled", n: sdnotify.Disabled()},
+	}
 
-			if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
-				t.Fatalf("failed to set deadline: %v", err)
-			}
+	for _, nn := range notifiers {
+		for _, tt := range tests {
+			t.Run(nn.name+"/"+tt.name, func(t *testing.T) {
+				err := tt.fn(nn.n)
+				if tt.notExist {
+					if !errors.Is(err, os.ErrNotExist) {
+						t.Fatalf("expected not exist, but got: %v", err)
+					}
+					return
+				}
 
-			// Echo back any received messages.
-			strC := make(chan string)
-			go func() {
-				b := make([]byte, 128)
-				n, _, err := pc.ReadFrom(b)
 				if err != nil {
-					panicf("failed to read: %v", err)
+					t.Fatalf("expected no-op, but got: %v", err)
 				}
+			})
+		}
+	}
+}
 
-				strC <- string(b[:n])
-			}()
+func TestStatusf(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		v      []interface{}
+		want   string
+	}{
+		{
+			name:   "OK",
+			format: "waiting %d",
+			v:      []interface{}{1},
+			want:   "STATUS=waiting 1",
+		},
+		{
+			name:   "newline format",
+			format: "line1\nline2",
+			want:   "STATUS=line1 line2",
+		},
+		{
+			name:   "newline and NUL value",
+			format: "error: %s",
+			v:      []interface{}{"bad\nconfig\x00"},
+			want:   "STATUS=error: bad config",
+		},
+	}
 
-			// Send a notification to the client and expect the same back after
-			// splitting on newlines added automatically by Notify.
-			n, err := sdnotify.Open(pc.LocalAddr().String())
-			if err != nil {
-				t.Fatalf("failed to open: %v", err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, sdnotify.Statusf(tt.format, tt.v...)); diff != "" {
+				t.Fatalf("unexpected status (-want +got):\n%s", diff)
 			}
-			defer n.Close()
+		})
+	}
+}
 
-			if err := n.Notify(tt.ss...); err != nil {
-				t.Fatalf("failed to notify: %v", err)
-			}
+func TestStatusDur(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		d      time.Duration
+		want   string
+	}{
+		{name: "zero", prefix: "uptime", want: "STATUS=uptime 0 milliseconds"},
+		{name: "milliseconds", prefix: "latency", d: 1500 * time.Microsecond, want: "STATUS=latency 2 milliseconds"},
+		{name: "one second", prefix: "waited", d: time.Second, want: "STATUS=waited 1 second"},
+		{name: "seconds", prefix: "waited", d: 5 * time.Second, want: "STATUS=waited 5 seconds"},
+		{
+			name:   "hours",
+			prefix: "uptime",
+			d:      time.Hour + 2*time.Minute + 5*time.Second + 400*time.Millisecond,
+			want:   "STATUS=uptime 1 hour 2 minutes 5 seconds",
+		},
+		{name: "whole minutes", prefix: "uptime", d: 3 * time.Minute, want: "STATUS=uptime 3 minutes"},
+		{name: "negative", prefix: "skew", d: -2 * time.Second, want: "STATUS=skew -2 seconds"},
+		{name: "no prefix", d: time.Minute, want: "STATUS=1 minute"},
+	}
 
-			if diff := cmp.Diff(tt.ss, strings.Split(<-strC, "\n")); diff != "" {
-				t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, sdnotify.StatusDur(tt.prefix, tt.d)); diff != "" {
+				t.Fatalf("unexpected status (-want +got):\n%s", diff)
 			}
 		})
 	}
 }
 
-func TestNotifierIntegration(t *testing.T) {
-	// Use a test binary in a fixed position and skip if unavailable.
-	const bin = "./sdnotifytest"
-	if _, err := os.Stat(bin); err != nil {
-		t.Skipf("skipping, cannot stat: %v", err)
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		ss   []string
+		want string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "one",
+			ss:   []string{sdnotify.Ready},
+			want: "READY=1",
+		},
+		{
+			name: "several",
+			ss:   []string{"STATUS=started", sdnotify.Ready},
+			want: "STATUS=started\nREADY=1",
+		},
 	}
 
-	// Find a file suitable for listening on a socket and clean it up
-	// immediately and after test execution.
-	f, err := ioutil.TempFile("", "sdnotifytest")
-	if err != nil {
-		t.Fatalf("failed to create temporary file: %v", err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, string(sdnotify.Encode(tt.ss...))); diff != "" {
+				t.Fatalf("unexpected encoding (-want +got):\n%s", diff)
+			}
+		})
 	}
-	_ = f.Close()
+}
 
-	remove := func() {
-		if err := os.RemoveAll(f.Name()); err != nil {
-			t.Fatalf("failed to remove temporary file: %v", err)
-		}
+func TestBusError(t *testing.T) {
+	tests := []struct {
+		name, bus string
+		ok        bool
+	}{
+		{name: "empty"},
+		{name: "one element", bus: "Error"},
+		{name: "empty element", bus: "org..Error"},
+		{name: "trailing dot", bus: "org.Error."},
+		{name: "leading digit", bus: "org.1Error"},
+		{name: "invalid character", bus: "org.Error-Foo"},
+		{name: "too long", bus: "org." + strings.Repeat("a", 252)},
+		{name: "OK", bus: "org.freedesktop.DBus.Error.TimedOut", ok: true},
+		{name: "OK underscore digits", bus: "com.example_1._Error2", ok: true},
 	}
-	remove()
-	defer remove()
 
-	pc, err := net.ListenPacket("unixgram", f.Name())
-	if err != nil {
-		t.Fatalf("failed to listen: %v", err)
-	}
-	defer pc.Close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := sdnotify.BusError(tt.bus)
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
 
-	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
-		t.Fatalf("failed to set deadline: %v", err)
-	}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to create notification: %v", err)
+			}
 
-	// Batch up all received notification messages and send them back to the
-	// main goroutine when the command finishes.
-	var wg sync.WaitGroup
-	wg.Add(1)
-	defer wg.Wait()
+			if diff := cmp.Diff("BUSERROR="+tt.bus, s); diff != "" {
+				t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
 
-	notifC := make(chan string)
-	go func() {
-		defer wg.Done()
+func TestExtendTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		d    time.Duration
+		s    string
+	}{
+		{
+			name: "nanosecond",
+			d:    1 * time.Nanosecond,
+			s:    "EXTEND_TIMEOUT_USEC=1",
+		},
+		{
+			name: "microsecond",
+			d:    1 * time.Microsecond,
+			s:    "EXTEND_TIMEOUT_USEC=1",
+		},
+		{
+			name: "30 seconds",
+			d:    30 * time.Second,
+			s:    "EXTEND_TIMEOUT_USEC=30000000",
+		},
+	}
 
-		var buf bytes.Buffer
-		b := make([]byte, 128)
-		for {
-			n, _, err := pc.ReadFrom(b)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := sdnotify.ExtendTimeout(tt.d)
 			if err != nil {
-				if strings.Contains(err.Error(), "use of closed") {
-					break
-				}
+				t.Fatalf("failed to create notification: %v", err)
+			}
 
-				panicf("failed to read: %v", err)
+			if diff := cmp.Diff(tt.s, s); diff != "" {
+				t.Fatalf("unexpected notification (-want +got):\n%s", diff)
 			}
+		})
+	}
 
-			_, _ = buf.Write(b[:n])
+	t.Run("zero", func(t *testing.T) {
+		if _, err := sdnotify.ExtendTimeout(0); err == nil {
+			t.Fatal("expected an error, but none occurred")
 		}
+	})
+}
 
-		notifC <- buf.String()
-	}()
+func TestNotifyAccess(t *testing.T) {
+	for _, access := range []string{"none", "main", "exec", "all"} {
+		s, err := sdnotify.NotifyAccess(access)
+		if err != nil {
+			t.Fatalf("failed to create notification: %v", err)
+		}
 
-	// Now that we've created a unixgram listener, invoke the test command with
-	// NOTIFY_SOCKET set in its environment.
-	cmd := exec.Command(bin)
-	cmd.Env = []string{sdnotify.Socket + "=" + f.Name()}
-	if b, err := cmd.CombinedOutput(); err != nil {
-		t.Fatalf("failed to run command: %v\nout:\n%s", err, string(b))
+		if diff := cmp.Diff("NOTIFYACCESS="+access, s); diff != "" {
+			t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+		}
 	}
-	_ = pc.Close()
 
-	// Only messages sent in the same batch are newline delimited.
-	const want = `STATUS=waiting 0STATUS=waiting 1STATUS=waiting 2READY=1
-STATUS=done
-STOPPING=1`
+	for _, access := range []string{"", "ALL", "main\n"} {
+		if _, err := sdnotify.NotifyAccess(access); err == nil {
+			t.Fatalf("expected an error for %q, but none occurred", access)
+		}
+	}
+}
+
+func TestOpenWriter(t *testing.T) {
+	var buf bytes.Buffer
+	n := sdnotify.OpenWriter(&buf)
+
+	if err := n.Notify(sdnotify.Statusf("starting")); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := n.Ready("started"); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := n.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
 
-	if diff := cmp.Diff(want, <-notifC); diff != "" {
+	const want = "STATUS=starting\nSTATUS=started\nREADY=1\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
 		t.Fatalf("unexpected notifications (-want +got):\n%s", diff)
 	}
 }
 
+func TestOpenTypeInvalid(t *testing.T) {
+	if _, err := sdnotify.OpenType("@foo", "tcp"); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
 // This example demonstrates typical use of a Notifier when starting a service,
 // indicating readiness, and shutting down the service.
 func ExampleNotifier() {
@@ -238,7 +570,3 @@ func ExampleNotifier() {
 		log.Fatalf("failed to send stopping notification: %v", err)
 	}
 }
-
-func panicf(format string, a ...interface{}) {
-	panic(fmt.Sprintf(format, a...))
-}
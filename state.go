@@ -0,0 +1,183 @@
+package sdnotify
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A State is a structured set of notifications which can be sent using
+// NotifyState. Only fields which are set to non-zero values are sent.
+type State struct {
+	// Status, if set, sends a STATUS notification with this value.
+	Status string
+
+	// Errno, if set, sends an ERRNO notification with this value.
+	Errno *int
+
+	// MainPID, if set, sends a MAINPID notification with this value.
+	MainPID *int
+
+	// ExtendTimeout, if set, sends an EXTEND_TIMEOUT_USEC notification with
+	// this value, which must be positive or NotifyState returns an error.
+	ExtendTimeout *time.Duration
+
+	// Watchdog, if true, sends a Watchdog notification.
+	Watchdog bool
+
+	// Reloading, if true, sends a Reloading notification along with a
+	// MonotonicUsec notification for the time at which NotifyState is called.
+	Reloading bool
+
+	// Ready, if true, sends a Ready notification.
+	Ready bool
+
+	// Stopping, if true, sends a Stopping notification.
+	Stopping bool
+}
+
+// NotifyState sends the notifications specified by s to systemd in a single
+// call to Notify. The notifications are always sent in the same order as the
+// fields of State are declared, so that STATUS and ERRNO precede the state
+// change notifications they describe, and MONOTONIC_USEC immediately precedes
+// RELOADING.
+//
+// If n is nil or Disabled, or s has no fields set, NotifyState is a no-op.
+func (n *Notifier) NotifyState(s State) error {
+	if n.disabled() {
+		return nil
+	}
+
+	ss, err := s.notifications(time.Now())
+	if err != nil {
+		return err
+	}
+
+	return n.Notify(ss...)
+}
+
+var (
+	_ encoding.TextMarshaler   = State{}
+	_ encoding.TextUnmarshaler = &State{}
+)
+
+// MarshalText implements encoding.TextMarshaler, producing the datagram which
+// NotifyState would send for s.
+func (s State) MarshalText() ([]byte, error) {
+	ss, err := s.notifications(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return Encode(ss...), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, parsing a datagram of
+// notifications into s as with Parse.
+func (s *State) UnmarshalText(b []byte) error {
+	ps, err := Parse(b)
+	if err != nil {
+		return err
+	}
+
+	*s = ps
+	return nil
+}
+
+// notifications produces the notification strings for s, using now as the time
+// for any MONOTONIC_USEC notification.
+func (s State) notifications(now time.Time) ([]string, error) {
+	var ss []string
+	if s.Status != "" {
+		ss = append(ss, "STATUS="+s.Status)
+	}
+	if s.Errno != nil {
+		ss = append(ss, Errno(*s.Errno))
+	}
+	if s.MainPID != nil {
+		ss = append(ss, MainPID(*s.MainPID))
+	}
+	if s.ExtendTimeout != nil {
+		et, err := ExtendTimeout(*s.ExtendTimeout)
+		if err != nil {
+			return nil, err
+		}
+
+		ss = append(ss, et)
+	}
+	if s.Watchdog {
+		ss = append(ss, Watchdog)
+	}
+	if s.Reloading {
+		ss = append(ss, MonotonicUsec(now), Reloading)
+	}
+	if s.Ready {
+		ss = append(ss, Ready)
+	}
+	if s.Stopping {
+		ss = append(ss, Stopping)
+	}
+
+	return ss, nil
+}
+
+// Parse parses the notifications in the datagram b, as received from a
+// service, into a State. Parse is intended for use with untrusted input: it
+// ignores empty lines and trailing whitespace, applies the last occurrence of
+// a repeated notification, and ignores notifications which State cannot
+// represent, such as MONOTONIC_USEC.
+//
+// Parse returns an error if a line is not a KEY=value assignment or if the
+// value of a known numeric notification cannot be parsed.
+func Parse(b []byte) (State, error) {
+	var s State
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return State{}, fmt.Errorf("sdnotify: malformed notification %q", line)
+		}
+
+		switch k {
+		case "STATUS":
+			s.Status = v
+		case "ERRNO", "MAINPID":
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return State{}, fmt.Errorf("sdnotify: invalid %s value %q", k, v)
+			}
+
+			if k == "ERRNO" {
+				s.Errno = &i
+			} else {
+				s.MainPID = &i
+			}
+		case "EXTEND_TIMEOUT_USEC":
+			// Reject values which would overflow a time.Duration.
+			usec, err := strconv.ParseUint(v, 10, 63)
+			if err != nil || usec > math.MaxInt64/uint64(time.Microsecond) {
+				return State{}, fmt.Errorf("sdnotify: invalid %s value %q", k, v)
+			}
+
+			d := time.Duration(usec) * time.Microsecond
+			s.ExtendTimeout = &d
+		case "WATCHDOG":
+			s.Watchdog = v == "1"
+		case "RELOADING":
+			s.Reloading = v == "1"
+		case "READY":
+			s.Ready = v == "1"
+		case "STOPPING":
+			s.Stopping = v == "1"
+		}
+	}
+
+	return s, nil
+}
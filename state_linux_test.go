@@ -0,0 +1,92 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierNotifyState(t *testing.T) {
+	var (
+		errno = 28
+		pid   = 1
+		d     = 30 * time.Second
+	)
+
+	tests := []struct {
+		name string
+		s    sdnotify.State
+		ss   []string
+	}{
+		{
+			name: "ready",
+			s: sdnotify.State{
+				Status: "started",
+				Ready:  true,
+			},
+			ss: []string{"STATUS=started", sdnotify.Ready},
+		},
+		{
+			name: "all",
+			s: sdnotify.State{
+				Stopping:      true,
+				Ready:         true,
+				Watchdog:      true,
+				ExtendTimeout: &d,
+				MainPID:       &pid,
+				Errno:         &errno,
+				Status:        "all",
+			},
+			ss: []string{
+				"STATUS=all",
+				"ERRNO=28",
+				"MAINPID=1",
+				"EXTEND_TIMEOUT_USEC=30000000",
+				sdnotify.Watchdog,
+				sdnotify.Ready,
+				sdnotify.Stopping,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, pc := testNotifier(t)
+
+			if err := n.NotifyState(tt.s); err != nil {
+				t.Fatalf("failed to notify: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.ss, strings.Split(readString(t, pc), "\n")); diff != "" {
+				t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNotifierNotifyStateInvalid(t *testing.T) {
+	n, _ := testNotifier(t)
+
+	var zero time.Duration
+	if err := n.NotifyState(sdnotify.State{ExtendTimeout: &zero}); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestNotifierNotifyStateReloading(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	if err := n.NotifyState(sdnotify.State{Reloading: true}); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	ss := strings.Split(readString(t, pc), "\n")
+	if len(ss) != 2 || !strings.HasPrefix(ss[0], "MONOTONIC_USEC=") || ss[1] != sdnotify.Reloading {
+		t.Fatalf("unexpected notification: %q", ss)
+	}
+}
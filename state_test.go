@@ -0,0 +1,177 @@
+package sdnotify_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestStateMarshalTextOrder(t *testing.T) {
+	var (
+		errno = 5
+		pid   = 1
+		d     = 5 * time.Second
+	)
+
+	// Set fields in a different order than they are declared to ensure the
+	// output order does not depend on it.
+	b, err := sdnotify.State{
+		Stopping:      true,
+		Ready:         true,
+		Reloading:     true,
+		Watchdog:      true,
+		ExtendTimeout: &d,
+		MainPID:       &pid,
+		Errno:         &errno,
+		Status:        "failed",
+	}.MarshalText()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	// MONOTONIC_USEC varies, so replace its value before comparing.
+	got := regexp.MustCompile(`MONOTONIC_USEC=\d+`).ReplaceAllString(string(b), "MONOTONIC_USEC=0")
+
+	const want = "STATUS=failed\nERRNO=5\nMAINPID=1\nEXTEND_TIMEOUT_USEC=5000000\n" +
+		"WATCHDOG=1\nMONOTONIC_USEC=0\nRELOADING=1\nREADY=1\nSTOPPING=1"
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestStateTextRoundTrip(t *testing.T) {
+	var (
+		errno = 5
+		pid   = 1
+		d     = 5 * time.Second
+	)
+
+	want := sdnotify.State{
+		Status:        "reloading",
+		Errno:         &errno,
+		MainPID:       &pid,
+		ExtendTimeout: &d,
+		Watchdog:      true,
+		Reloading:     true,
+		Ready:         true,
+		Stopping:      true,
+	}
+
+	b, err := want.MarshalText()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	var got sdnotify.State
+	if err := got.UnmarshalText(b); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected state (-want +got):\n%s", diff)
+	}
+}
+
+func TestStateUnmarshalText(t *testing.T) {
+	tests := []struct {
+		name string
+		b    string
+		want sdnotify.State
+		ok   bool
+	}{
+		{
+			name: "unknown",
+			b:    "FDSTORE=1\nX_CUSTOM=foo\nREADY=1",
+			want: sdnotify.State{Ready: true},
+			ok:   true,
+		},
+		{
+			name: "watchdog trigger",
+			b:    "WATCHDOG=trigger",
+			ok:   true,
+		},
+		{
+			name: "missing equals",
+			b:    "READY",
+		},
+		{
+			name: "bad errno",
+			b:    "ERRNO=foo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got sdnotify.State
+			err := got.UnmarshalText([]byte(tt.b))
+			if tt.ok && err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				return
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected state (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	want := sdnotify.State{Status: "second", Ready: true}
+
+	got, err := sdnotify.Parse([]byte("\nSTATUS=first\r\nSTATUS=second  \n\nREADY=1\t\n"))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected state (-want +got):\n%s", diff)
+	}
+
+	if _, err := sdnotify.Parse([]byte("EXTEND_TIMEOUT_USEC=9223372036854775807")); err == nil {
+		t.Fatal("expected overflow error")
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, s := range []string{
+		"READY=1",
+		"STATUS=starting\nERRNO=5\nMAINPID=1\nEXTEND_TIMEOUT_USEC=1000",
+		"MONOTONIC_USEC=1\nRELOADING=1",
+		"STOPPING=1\nWATCHDOG=1\n\n",
+		"READY",
+	} {
+		f.Add([]byte(s))
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		s, err := sdnotify.Parse(b)
+		if err != nil {
+			return
+		}
+
+		// Any State which can be sent again must parse to the same State.
+		out, err := s.MarshalText()
+		if err != nil {
+			return
+		}
+
+		got, err := sdnotify.Parse(out)
+		if err != nil {
+			t.Fatalf("failed to parse marshaled state %q: %v", out, err)
+		}
+
+		if diff := cmp.Diff(s, got); diff != "" {
+			t.Fatalf("unexpected round trip state (-want +got):\n%s", diff)
+		}
+	})
+}
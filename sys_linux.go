@@ -0,0 +1,85 @@
+//go:build linux
+
+package sdnotify
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// supported reports whether systemd notifications are available on this
+// platform.
+const supported = true
+
+// monotonicNow reads the current CLOCK_MONOTONIC value.
+func monotonicNow() time.Duration {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		// CLOCK_MONOTONIC is always available on Linux.
+		panicf("sdnotify: failed to read CLOCK_MONOTONIC: %v", err)
+	}
+
+	return time.Duration(ts.Nano())
+}
+
+// msgTrunc is set in the flags of a received message which was truncated.
+const msgTrunc = unix.MSG_TRUNC
+
+// A ucred holds the credentials sent by a Notifier created by OpenPID.
+type ucred = unix.Ucred
+
+// newUcred creates credentials for pid with the current user and group.
+func newUcred(pid int) *ucred {
+	return &unix.Ucred{
+		Pid: int32(pid),
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+}
+
+// credsOOB encodes c as SCM_CREDENTIALS ancillary data.
+func credsOOB(c *ucred) []byte { return unix.UnixCredentials(c) }
+
+// rightsOOB encodes fds as SCM_RIGHTS ancillary data.
+func rightsOOB(fds []int) ([]byte, error) { return unix.UnixRights(fds...), nil }
+
+// sendmsg sends b with ancillary data oob on the connected socket fd.
+func sendmsg(fd uintptr, b, oob []byte) error {
+	return unix.Sendmsg(int(fd), b, oob, nil, 0)
+}
+
+// setsockoptPassCred enables SO_PASSCRED on the socket fd.
+func setsockoptPassCred(fd uintptr) error {
+	return unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PASSCRED, 1)
+}
+
+// dup duplicates fd. If cloexec is set, the duplicate is marked close-on-exec.
+func dup(fd int, cloexec bool) (int, error) {
+	if cloexec {
+		return unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 0)
+	}
+
+	// Unlike F_DUPFD_CLOEXEC, dup leaves the new descriptor inheritable.
+	return unix.Dup(fd)
+}
+
+// isStreamSocket reports whether the socket fd is connection-oriented, such as
+// a TCP or UNIX stream listener, rather than a datagram socket.
+func isStreamSocket(fd int) (bool, error) {
+	typ, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TYPE)
+	if err != nil {
+		return false, os.NewSyscallError("getsockopt", err)
+	}
+
+	return typ == unix.SOCK_STREAM || typ == unix.SOCK_SEQPACKET, nil
+}
+
+// prepareListenFD marks the inherited descriptor fd close-on-exec as
+// sd_listen_fds does, and non-blocking so that os.NewFile can use the runtime
+// poller.
+func prepareListenFD(fd int) error {
+	unix.CloseOnExec(fd)
+	return unix.SetNonblock(fd, true)
+}
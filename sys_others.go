@@ -0,0 +1,45 @@
+//go:build !linux
+
+package sdnotify
+
+import (
+	"errors"
+	"time"
+)
+
+// supported reports whether systemd notifications are available on this
+// platform. Elsewhere, New and NewFromEnv return a Disabled Notifier.
+const supported = false
+
+// errUnsupported is returned by operations which require Linux.
+var errUnsupported = errors.New("sdnotify: operation is only supported on Linux")
+
+// start approximates a monotonic clock origin on platforms without
+// CLOCK_MONOTONIC, where systemd cannot consume MONOTONIC_USEC anyway.
+var start = time.Now()
+
+// monotonicNow returns the time elapsed since the package was initialized.
+func monotonicNow() time.Duration { return time.Since(start) }
+
+// msgTrunc is unavailable, so truncated messages cannot be detected.
+const msgTrunc = 0
+
+// A ucred holds the credentials sent by a Notifier created by OpenPID, which
+// is unsupported on this platform.
+type ucred struct{}
+
+func newUcred(_ int) *ucred { return &ucred{} }
+
+func credsOOB(_ *ucred) []byte { return nil }
+
+func rightsOOB(_ []int) ([]byte, error) { return nil, errNoControl }
+
+func sendmsg(_ uintptr, _, _ []byte) error { return errNoControl }
+
+func setsockoptPassCred(_ uintptr) error { return errUnsupported }
+
+func dup(_ int, _ bool) (int, error) { return 0, errUnsupported }
+
+func isStreamSocket(_ int) (bool, error) { return false, errUnsupported }
+
+func prepareListenFD(_ int) error { return errUnsupported }
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package sdnotify_test
+
+import (
+	"testing"
+
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNewUnsupported(t *testing.T) {
+	t.Setenv(sdnotify.Socket, "/run/systemd/notify")
+
+	n, err := sdnotify.New()
+	if err != nil {
+		t.Fatalf("failed to create Notifier: %v", err)
+	}
+	if n == nil {
+		t.Fatal("expected non-nil disabled Notifier")
+	}
+
+	if err := n.Notify(sdnotify.Ready); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if err := n.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+}
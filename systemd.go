@@ -0,0 +1,55 @@
+package sdnotify
+
+import (
+	"os"
+	"strconv"
+)
+
+// UnderSystemd reports whether the process appears to be running as part of a
+// systemd unit, as indicated by the INVOCATION_ID environment variable which
+// systemd v232+ sets for every unit, or by NOTIFY_SOCKET.
+//
+// Unlike New, UnderSystemd does not require the unit to use Type=notify, so it
+// is useful for changes such as logging in a journald-friendly format. Child
+// processes inherit the environment, so UnderSystemd also reports true for
+// processes started by a program running under systemd.
+func UnderSystemd() bool {
+	return os.Getenv(InvocationIDEnv) != "" || os.Getenv(Socket) != ""
+}
+
+// InvocationID returns the ID of the current invocation of the service's unit,
+// as set by systemd in the INVOCATION_ID environment variable. Services may log
+// it to correlate their output with 'journalctl _SYSTEMD_INVOCATION_ID=<id>'.
+//
+// If INVOCATION_ID is unset or is not a 128-bit ID formatted as 32 hexadecimal
+// characters, InvocationID returns false.
+func InvocationID() (string, bool) {
+	id := os.Getenv(InvocationIDEnv)
+	if len(id) != 32 {
+		return "", false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+		default:
+			return "", false
+		}
+	}
+
+	return id, true
+}
+
+// ExecPIDMatches reports whether the current process is the one systemd
+// executed for the service, as identified by the SYSTEMD_EXEC_PID environment
+// variable which systemd v248+ sets. With NotifyAccess=main, systemd only
+// accepts notifications from the service's main process, so a process started
+// by a wrapper or shell script, or one which forked after being executed, may
+// find that its notifications are silently ignored. Services can use
+// ExecPIDMatches to warn about such a configuration before sending Ready.
+//
+// If SYSTEMD_EXEC_PID is unset or invalid, ExecPIDMatches returns false.
+func ExecPIDMatches() bool {
+	pid, err := strconv.Atoi(os.Getenv(ExecPID))
+	return err == nil && pid > 0 && pid == os.Getpid()
+}
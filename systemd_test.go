@@ -0,0 +1,85 @@
+package sdnotify_test
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestUnderSystemd(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		socket string
+		ok     bool
+	}{
+		{name: "none"},
+		{name: "invocation ID", id: "0123456789abcdef0123456789abcdef", ok: true},
+		{name: "notify socket", socket: "/run/systemd/notify", ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(sdnotify.InvocationIDEnv, tt.id)
+			t.Setenv(sdnotify.Socket, tt.socket)
+
+			if got := sdnotify.UnderSystemd(); got != tt.ok {
+				t.Fatalf("unexpected under systemd: %v", got)
+			}
+		})
+	}
+}
+
+func TestInvocationID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		ok   bool
+	}{
+		{name: "unset"},
+		{name: "OK", id: "0123456789abcdef0123456789abcdef", ok: true},
+		{name: "upper case", id: "0123456789ABCDEF0123456789ABCDEF", ok: true},
+		{name: "short", id: "0123456789abcdef"},
+		{name: "UUID", id: "01234567-89ab-cdef-0123-456789abcdef"},
+		{name: "not hex", id: "0123456789abcdef0123456789abcdeg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(sdnotify.InvocationIDEnv, tt.id)
+
+			id, ok := sdnotify.InvocationID()
+			if ok != tt.ok {
+				t.Fatalf("unexpected ok: %v", ok)
+			}
+			if ok && id != tt.id {
+				t.Fatalf("unexpected invocation ID: %q", id)
+			}
+		})
+	}
+}
+
+func TestExecPIDMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		pid  string
+		ok   bool
+	}{
+		{name: "unset"},
+		{name: "OK", pid: strconv.Itoa(os.Getpid()), ok: true},
+		{name: "other", pid: strconv.Itoa(os.Getpid() + 1)},
+		{name: "invalid", pid: "foo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(sdnotify.ExecPID, tt.pid)
+
+			if got := sdnotify.ExecPIDMatches(); got != tt.ok {
+				t.Fatalf("unexpected exec PID match: %v", got)
+			}
+		})
+	}
+}
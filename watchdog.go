@@ -0,0 +1,230 @@
+package sdnotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// WatchdogEnabled reports whether the service manager expects the service to
+// send periodic Watchdog notifications, as described in
+// https://www.freedesktop.org/software/systemd/man/sd_watchdog_enabled.html.
+//
+// If the WATCHDOG_USEC environment variable is set, WatchdogEnabled returns
+// the configured watchdog timeout and true. If WATCHDOG_USEC is unset or the
+// WATCHDOG_PID environment variable is set to a PID other than that of the
+// current process, WatchdogEnabled returns false. An error is returned if
+// either variable cannot be parsed.
+//
+// To avoid spurious watchdog failures, services should send a Watchdog
+// notification every half of the returned duration.
+func WatchdogEnabled() (time.Duration, bool, error) {
+	return watchdogEnabled(os.Getenv)
+}
+
+// WatchdogEnabled is like the package-level WatchdogEnabled, but reads
+// environment variables from n's environment, such as the one passed to
+// NewFromEnv. If n is nil, the process environment is used.
+func (n *Notifier) WatchdogEnabled() (time.Duration, bool, error) {
+	return watchdogEnabled(n.getenv)
+}
+
+// watchdogEnabled implements WatchdogEnabled using getenv to read environment
+// variables.
+func watchdogEnabled(getenv func(string) string) (time.Duration, bool, error) {
+	us := getenv(WatchdogUsec)
+	if us == "" {
+		return 0, false, nil
+	}
+
+	if ps := getenv(WatchdogPID); ps != "" {
+		pid, err := strconv.Atoi(ps)
+		if err != nil || pid <= 0 {
+			return 0, false, fmt.Errorf("sdnotify: invalid WATCHDOG_PID %q", ps)
+		}
+
+		if pid != os.Getpid() {
+			// The watchdog is intended for another process.
+			return 0, false, nil
+		}
+	}
+
+	usec, err := strconv.ParseUint(us, 10, 63)
+	if err != nil || usec == 0 {
+		return 0, false, fmt.Errorf("sdnotify: invalid WATCHDOG_USEC %q", us)
+	}
+
+	return time.Duration(usec) * time.Microsecond, true, nil
+}
+
+// StartWatchdog starts a goroutine which sends a Watchdog notification every
+// half of the duration reported by WatchdogEnabled, adjusted by any jitter
+// configured using WithWatchdogJitter, until ctx is canceled. If n was created
+// by NewFromEnv, its environment is used in place of the process environment.
+//
+// Any errors which occur while sending notifications are sent on the returned
+// channel, which is closed when the goroutine stops. Errors are discarded if
+// the channel is not being received from, so a failing send never delays the
+// next watchdog notification.
+//
+// If n is nil or Disabled, or the watchdog is not enabled, StartWatchdog starts
+// no goroutine and returns a closed channel.
+func (n *Notifier) StartWatchdog(ctx context.Context) (<-chan error, error) {
+	errC := make(chan error, 1)
+	if n.disabled() {
+		close(errC)
+		return errC, nil
+	}
+
+	d, ok, err := watchdogEnabled(n.getenv)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		close(errC)
+		return errC, nil
+	}
+
+	go func() {
+		defer close(errC)
+
+		t := time.NewTimer(n.watchdogInterval(d))
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				t.Reset(n.watchdogInterval(d))
+			}
+
+			err := n.Notify(Watchdog)
+			n.background(err)
+			if err != nil {
+				select {
+				case errC <- err:
+				default:
+				}
+			}
+		}
+	}()
+
+	return errC, nil
+}
+
+// WatchdogLoop sends a notification every half of the duration reported by
+// WatchdogEnabled, adjusted as with StartWatchdog, gating each Watchdog
+// notification on the result of check. This turns the systemd watchdog into a
+// liveness probe driven by the application's own notion of health. If n was
+// created by NewFromEnv, its environment is used in place of the process
+// environment.
+//
+// On each tick, if check returns nil, a Watchdog notification is sent. If check
+// returns an error, a WatchdogTrigger notification is sent so that systemd
+// acts on the failure immediately, and WatchdogLoop returns an error wrapping
+// the error from check.
+//
+// WatchdogLoop blocks until ctx is canceled, check fails, or a notification
+// cannot be sent. If n is nil or Disabled, or the watchdog is not enabled,
+// WatchdogLoop returns nil immediately.
+func (n *Notifier) WatchdogLoop(ctx context.Context, check func() error) error {
+	if n.disabled() {
+		return nil
+	}
+
+	d, ok, err := watchdogEnabled(n.getenv)
+	if err != nil || !ok {
+		return err
+	}
+
+	t := time.NewTimer(n.watchdogInterval(d))
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			t.Reset(n.watchdogInterval(d))
+		}
+
+		if cerr := check(); cerr != nil {
+			err := fmt.Errorf("sdnotify: watchdog health check failed: %w", cerr)
+			if nerr := n.NotifyContext(ctx, WatchdogTrigger); nerr != nil {
+				return errors.Join(err, nerr)
+			}
+
+			return err
+		}
+
+		if err := n.NotifyContext(ctx, Watchdog); err != nil {
+			return err
+		}
+	}
+}
+
+// TriggerRestart sends a WatchdogTrigger notification, causing systemd to
+// immediately handle the service as if its watchdog timeout had elapsed, for
+// example by restarting it when the unit sets Restart=on-watchdog or
+// Restart=on-failure. It is intended for crash-handling paths; use
+// WatchdogLoop to report failed health checks. If n is nil or Disabled,
+// TriggerRestart is a no-op.
+func (n *Notifier) TriggerRestart() error {
+	n.stopStartup()
+	return n.Notify(WatchdogTrigger)
+}
+
+// TriggerOnPanic recovers a panic, sends a STATUS notification describing it
+// and a WatchdogTrigger notification, and then panics again with the same
+// value so that the panic is still reported. It must be deferred directly by
+// the function which may panic, such as main or a goroutine's top-level
+// function:
+//
+//	defer n.TriggerOnPanic()
+//
+// If no panic occurred, TriggerOnPanic does nothing. If n is nil or Disabled,
+// the panic is propagated without sending any notifications.
+func (n *Notifier) TriggerOnPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	n.stopStartup()
+	_ = n.Notify(Statusf("panic: %v", r), WatchdogTrigger)
+	panic(r)
+}
+
+// maxWatchdogJitter bounds the fraction accepted by WithWatchdogJitter so that
+// a jittered interval always leaves a margin before the watchdog timeout.
+const maxWatchdogJitter = 0.5
+
+// watchdogInterval returns the time to wait before the next Watchdog
+// notification for the watchdog timeout d, applying any configured jitter.
+func (n *Notifier) watchdogInterval(d time.Duration) time.Duration {
+	if n.parent != nil {
+		return n.parent.watchdogInterval(d)
+	}
+
+	base := d / 2
+	j := n.jitter
+	if j <= 0 {
+		return base
+	}
+	if j > maxWatchdogJitter {
+		j = maxWatchdogJitter
+	}
+
+	// Pick an offset uniformly in [-j*base, j*base].
+	max := int64(j * float64(base))
+	if max <= 0 {
+		return base
+	}
+
+	return base + time.Duration(rand.Int63n(2*max+1)-max)
+}
@@ -0,0 +1,238 @@
+//go:build linux
+
+package sdnotify_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestNotifierStartWatchdogDisabled(t *testing.T) {
+	t.Setenv(sdnotify.WatchdogUsec, "")
+
+	n, _ := testNotifier(t)
+
+	errC, err := n.StartWatchdog(context.Background())
+	if err != nil {
+		t.Fatalf("failed to start watchdog: %v", err)
+	}
+
+	if _, ok := <-errC; ok {
+		t.Fatal("expected closed error channel")
+	}
+}
+
+func TestNotifierStartWatchdog(t *testing.T) {
+	t.Setenv(sdnotify.WatchdogUsec, strconv.Itoa(int((20 * time.Millisecond).Microseconds())))
+
+	n, pc := testNotifier(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errC, err := n.StartWatchdog(ctx)
+	if err != nil {
+		t.Fatalf("failed to start watchdog: %v", err)
+	}
+
+	// Expect several watchdog notifications before stopping the goroutine.
+	for i := 0; i < 3; i++ {
+		if diff := cmp.Diff(sdnotify.Watchdog, readString(t, pc)); diff != "" {
+			t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+		}
+	}
+
+	cancel()
+	for err := range errC {
+		t.Fatalf("failed to send watchdog notification: %v", err)
+	}
+}
+
+func TestNewFromEnvStartWatchdog(t *testing.T) {
+	// Ensure the process environment cannot enable the watchdog.
+	t.Setenv(sdnotify.WatchdogUsec, "")
+
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	env := map[string]string{
+		sdnotify.Socket:       pc.LocalAddr().String(),
+		sdnotify.WatchdogUsec: strconv.Itoa(int((20 * time.Millisecond).Microseconds())),
+	}
+
+	n, err := sdnotify.NewFromEnv(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("failed to create notifier: %v", err)
+	}
+	defer n.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errC, err := n.StartWatchdog(ctx)
+	if err != nil {
+		t.Fatalf("failed to start watchdog: %v", err)
+	}
+
+	if diff := cmp.Diff(sdnotify.Watchdog, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	cancel()
+	for err := range errC {
+		t.Fatalf("failed to send watchdog notification: %v", err)
+	}
+}
+
+func TestNewFromEnvNotExist(t *testing.T) {
+	_, err := sdnotify.NewFromEnv(func(string) string { return "" })
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+}
+
+func TestNotifierWatchdogLoop(t *testing.T) {
+	t.Setenv(sdnotify.WatchdogUsec, strconv.Itoa(int((20 * time.Millisecond).Microseconds())))
+
+	n, pc := testNotifier(t)
+
+	// Report healthy twice and then fail.
+	var (
+		calls   int
+		errSick = errors.New("sick")
+	)
+
+	check := func() error {
+		calls++
+		if calls > 2 {
+			return errSick
+		}
+
+		return nil
+	}
+
+	if err := n.WatchdogLoop(context.Background(), check); !errors.Is(err, errSick) {
+		t.Fatalf("expected health check error, but got: %v", err)
+	}
+
+	want := []string{sdnotify.Watchdog, sdnotify.Watchdog, sdnotify.WatchdogTrigger}
+	for _, w := range want {
+		if diff := cmp.Diff(w, readString(t, pc)); diff != "" {
+			t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestNotifierWatchdogLoopCanceled(t *testing.T) {
+	t.Setenv(sdnotify.WatchdogUsec, strconv.Itoa(int((20 * time.Millisecond).Microseconds())))
+
+	n, _ := testNotifier(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := n.WatchdogLoop(ctx, func() error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, but got: %v", err)
+	}
+}
+
+func TestNotifierStartWatchdogJitter(t *testing.T) {
+	const d = 200 * time.Millisecond
+	t.Setenv(sdnotify.WatchdogUsec, strconv.Itoa(int(d.Microseconds())))
+
+	pc, err := net.ListenPacket("unixgram", "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	// The fraction is clamped so that pings still arrive well within d.
+	n, err := sdnotify.Open(pc.LocalAddr().String(), sdnotify.WithWatchdogJitter(1))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer n.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errC, err := n.StartWatchdog(ctx)
+	if err != nil {
+		t.Fatalf("failed to start watchdog: %v", err)
+	}
+
+	last := time.Now()
+	for i := 0; i < 4; i++ {
+		if diff := cmp.Diff(sdnotify.Watchdog, readString(t, pc)); diff != "" {
+			t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+		}
+
+		if since := time.Since(last); since >= d {
+			t.Fatalf("watchdog ping took %s, exceeding timeout %s", since, d)
+		}
+		last = time.Now()
+	}
+
+	cancel()
+	for err := range errC {
+		t.Fatalf("failed to send watchdog notification: %v", err)
+	}
+}
+
+func TestNotifierTriggerRestart(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	if err := n.TriggerRestart(); err != nil {
+		t.Fatalf("failed to trigger restart: %v", err)
+	}
+
+	if diff := cmp.Diff(sdnotify.WatchdogTrigger, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifierTriggerOnPanic(t *testing.T) {
+	n, pc := testNotifier(t)
+
+	r := func() (r any) {
+		defer func() { r = recover() }()
+		defer n.TriggerOnPanic()
+
+		panic("boom")
+	}()
+	if r != "boom" {
+		t.Fatalf("unexpected recovered value: %v", r)
+	}
+
+	if diff := cmp.Diff("STATUS=panic: boom\n"+sdnotify.WatchdogTrigger, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+
+	// No notification is sent without a panic.
+	func() { defer n.TriggerOnPanic() }()
+	if err := n.Notify(sdnotify.Watchdog); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if diff := cmp.Diff(sdnotify.Watchdog, readString(t, pc)); diff != "" {
+		t.Fatalf("unexpected notification (-want +got):\n%s", diff)
+	}
+}
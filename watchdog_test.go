@@ -0,0 +1,102 @@
+package sdnotify_test
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/sdnotify"
+)
+
+func TestWatchdogEnabled(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		name       string
+		usec, pid  string
+		d          time.Duration
+		ok, errors bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:   "bad usec",
+			usec:   "foo",
+			errors: true,
+		},
+		{
+			name:   "zero usec",
+			usec:   "0",
+			errors: true,
+		},
+		{
+			name:   "bad pid",
+			usec:   "1000000",
+			pid:    "foo",
+			errors: true,
+		},
+		{
+			name: "other pid",
+			usec: "1000000",
+			pid:  strconv.Itoa(os.Getpid() + 1),
+		},
+		{
+			name: "OK no pid",
+			usec: "1000000",
+			d:    1 * time.Second,
+			ok:   true,
+		},
+		{
+			name: "OK pid",
+			usec: "30000000",
+			pid:  pid,
+			d:    30 * time.Second,
+			ok:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(sdnotify.WatchdogUsec, tt.usec)
+			t.Setenv(sdnotify.WatchdogPID, tt.pid)
+
+			d, ok, err := sdnotify.WatchdogEnabled()
+			if tt.errors {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to check watchdog: %v", err)
+			}
+
+			if tt.d != d || tt.ok != ok {
+				t.Fatalf("unexpected watchdog state: want (%s, %t), got (%s, %t)",
+					tt.d, tt.ok, d, ok)
+			}
+		})
+	}
+}
+
+func TestNotifierWatchdogEnabled(t *testing.T) {
+	// Only the Notifier's environment may enable the watchdog.
+	t.Setenv(sdnotify.WatchdogUsec, "")
+
+	env := map[string]string{sdnotify.WatchdogUsec: "1000000"}
+	n, err := sdnotify.NewFromEnv(func(key string) string { return env[key] }, sdnotify.WithDryRun(true))
+	if err != nil {
+		t.Fatalf("failed to create notifier: %v", err)
+	}
+
+	d, ok, err := n.WatchdogEnabled()
+	if err != nil {
+		t.Fatalf("failed to check watchdog: %v", err)
+	}
+	if d != time.Second || !ok {
+		t.Fatalf("unexpected watchdog state: want (1s, true), got (%s, %t)", d, ok)
+	}
+}